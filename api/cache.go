@@ -0,0 +1,245 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"micahco/sapi/spotify"
+)
+
+const (
+	// CacheHit : response served from the cache (fresh or revalidated)
+	CacheHit = "HIT"
+	// CacheMiss : response fetched from Spotify
+	CacheMiss = "MISS"
+)
+
+// CacheEntry : cached Spotify response body
+type CacheEntry struct {
+	Body    []byte    `json:"body"`
+	ETag    string    `json:"etag"`
+	Expires time.Time `json:"expires"`
+}
+
+// Cache : storage for cached responses. Expired entries are still returned so
+// they can be revalidated with their ETag.
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry)
+}
+
+// LRUCache : in-memory cache holding at most size entries
+type LRUCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCache : create an in-memory cache holding at most size entries
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get : fetch an entry and mark it recently used
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+// Set : store an entry, evicting the least recently used when full
+func (c *LRUCache) Set(key string, e *CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruItem).entry = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruItem{key: key, entry: e})
+	for c.size > 0 && c.order.Len() > c.size {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.items, last.Value.(*lruItem).key)
+	}
+}
+
+// DiskCache : cache stored as one json file per entry in a directory
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache : create a cache in dir, creating it if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get : read an entry from disk
+func (c *DiskCache) Get(key string) (*CacheEntry, bool) {
+	file, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e CacheEntry
+	if err := json.Unmarshal(file, &e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+// Set : write an entry to disk, a failed write only costs a cache miss
+func (c *DiskCache) Set(key string, e *CacheEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	p := c.path(key)
+	tmp := fmt.Sprintf("%s.%s.tmp", p, GenerateRandomString(6))
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// NewCache : create the cache selected by kind ("memory" or "disk"), nil when kind is empty
+func NewCache(kind string, path string, size int) (Cache, error) {
+	switch kind {
+	case "":
+		return nil, nil
+	case "memory":
+		return NewLRUCache(size), nil
+	case "disk":
+		return NewDiskCache(path)
+	default:
+		return nil, fmt.Errorf("Unknown cache %q", kind)
+	}
+}
+
+// ResponseCache : caches read-only Spotify GETs with a ttl per kind of
+// endpoint and coalesces concurrent identical fetches
+type ResponseCache struct {
+	cache     Cache
+	client    *spotify.Client
+	ttls      map[string]time.Duration
+	coalescer *Coalescer
+}
+
+// NewResponseCache : cache responses from client in cache, a nil cache fetches every time
+func NewResponseCache(cache Cache, client *spotify.Client, ttls map[string]time.Duration) *ResponseCache {
+	return &ResponseCache{
+		cache:     cache,
+		client:    client,
+		ttls:      ttls,
+		coalescer: NewCoalescer(),
+	}
+}
+
+// Get : GET endpoint through the cache and decode it into v. kind selects the
+// ttl ("artist", "track", "search"). Returns CacheHit or CacheMiss.
+func (c *ResponseCache) Get(ctx context.Context, token string, kind string, endpoint string, v interface{}) (string, error) {
+	ttl := c.ttls[kind]
+	if c.cache == nil || ttl <= 0 {
+		ttl = 0
+	}
+	var cached *CacheEntry
+	if ttl > 0 {
+		if e, ok := c.cache.Get(endpoint); ok {
+			if time.Now().Before(e.Expires) {
+				return CacheHit, json.Unmarshal(e.Body, v)
+			}
+			cached = e
+		}
+	}
+	// the access token scopes a coalesced call to one user. The fetch is shared,
+	// so it mustn't be cancelled with whichever request started it.
+	key := token + " " + endpoint
+	val, _, err := c.coalescer.Do(ctx, key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), ClientTimeout)
+		defer cancel()
+		return c.fetch(fetchCtx, token, endpoint, cached, ttl)
+	})
+	if err != nil {
+		return CacheMiss, err
+	}
+	f := val.(*fetched)
+	return f.status, json.Unmarshal(f.body, v)
+}
+
+type fetched struct {
+	body   []byte
+	status string
+}
+
+// fetch : GET endpoint from Spotify, revalidating a stale cached entry and
+// storing the result when ttl is set
+func (c *ResponseCache) fetch(ctx context.Context, token string, endpoint string, cached *CacheEntry, ttl time.Duration) (*fetched, error) {
+	etag := ""
+	if cached != nil {
+		etag = cached.ETag
+	}
+	res, err := c.client.GetConditional(ctx, token, endpoint, etag)
+	if err != nil {
+		return nil, err
+	}
+	if res.NotModified {
+		if cached == nil {
+			return nil, errors.New("Not modified response without cached entry")
+		}
+		c.cache.Set(endpoint, &CacheEntry{Body: cached.Body, ETag: res.ETag, Expires: time.Now().Add(ttl)})
+		return &fetched{body: cached.Body, status: CacheHit}, nil
+	}
+	if !json.Valid(res.Body) {
+		return nil, errors.New("Invalid json from Spotify")
+	}
+	if ttl > 0 {
+		c.cache.Set(endpoint, &CacheEntry{Body: res.Body, ETag: res.ETag, Expires: time.Now().Add(ttl)})
+	}
+	return &fetched{body: res.Body, status: CacheMiss}, nil
+}
+
+// ParseCacheTTLs : parse config ttls like {"artist": "24h"}
+func ParseCacheTTLs(ttls map[string]string) (map[string]time.Duration, error) {
+	parsed := make(map[string]time.Duration, len(ttls))
+	for kind, s := range ttls {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("Cache ttl for %s: %v", kind, err)
+		}
+		parsed[kind] = d
+	}
+	return parsed, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+)
+
+// coalesceStats : published at /debug/vars as "coalesce"
+var coalesceStats = expvar.NewMap("coalesce")
+
+// Coalescer : shares one call between concurrent callers using the same key
+type Coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+type coalescedCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// NewCoalescer : create an empty coalescer
+func NewCoalescer() *Coalescer {
+	return &Coalescer{calls: make(map[string]*coalescedCall)}
+}
+
+// Do : run fn unless a call with key is already in flight, in which case wait
+// for it and return its result. shared reports whether the result came from
+// another caller's call. fn runs detached from every caller, so it should
+// carry its own timeout; each caller stops waiting when its ctx is done.
+func (c *Coalescer) Do(ctx context.Context, key string, fn func() (interface{}, error)) (val interface{}, shared bool, err error) {
+	coalesceStats.Add("requests", 1)
+	c.mu.Lock()
+	call, shared := c.calls[key]
+	if shared {
+		coalesceStats.Add("coalesced", 1)
+	} else {
+		call = &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		coalesceStats.Add("upstream", 1)
+		go c.run(key, call, fn)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	case <-call.done:
+		return call.val, shared, call.err
+	}
+}
+
+// run : call fn for call, releasing its waiters and key even if fn panics
+func (c *Coalescer) run(key string, call *coalescedCall, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.val, call.err = nil, fmt.Errorf("Coalesced call panicked: %v", r)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn()
+}
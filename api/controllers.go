@@ -1,163 +1,156 @@
 package main
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
-	"net/url"
-	"time"
+	"strconv"
+
+	"micahco/sapi/spotify"
 )
 
 // SendError : send an error response back the the user
 func SendError(w http.ResponseWriter, code int, message string) {
+	SendErrorReason(w, code, DefaultReason(code), message)
+}
+
+// SendErrorReason : send an error response with a machine-readable reason
+func SendErrorReason(w http.ResponseWriter, code int, reason string, message string) {
 	var e ErrorResponse
 	e.Code = code
+	e.Reason = reason
 	e.Message = message
+	sendErrorResponse(w, e)
+}
+
+// SendValidationError : send a 422 listing every field that failed validation
+func SendValidationError(w http.ResponseWriter, fields []FieldError) {
+	var e ErrorResponse
+	e.Code = http.StatusUnprocessableEntity
+	e.Reason = "invalid_request"
+	e.Message = "Invalid request parameters"
+	e.Fields = fields
+	sendErrorResponse(w, e)
+}
+
+func sendErrorResponse(w http.ResponseWriter, e ErrorResponse) {
 	body, err := json.Marshal(e)
 	if err != nil {
 		SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	w.WriteHeader(e.Code)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Code)
 	w.Write(body)
 }
 
+// DefaultReason : machine-readable reason for a status code
+func DefaultReason(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusBadGateway:
+		return "upstream_error"
+	case http.StatusServiceUnavailable:
+		return "upstream_unavailable"
+	case http.StatusGatewayTimeout:
+		return "upstream_timeout"
+	}
+	if code >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
+
 // SendBadRequest : send a method error
 func SendBadRequest(w http.ResponseWriter, method string) {
 	msg := fmt.Sprintf("Endpoint doesn't support %s request", method)
 	SendError(w, http.StatusBadRequest, msg)
 }
 
-// SpotifyGet : make a GET request to Spotify API
-func SpotifyGet(r *http.Request, endpoint string, accessToken string) (*http.Response, error) {
-	client := &http.Client{Timeout: ClientTimeout}
-	u := fmt.Sprintf("https://api.spotify.com/v1%s", endpoint)
-	req, err := http.NewRequest("GET", u, nil)
+// SendJSON : send v as a json response
+func SendJSON(w http.ResponseWriter, code int, v interface{}) {
+	body, err := json.Marshal(v)
 	if err != nil {
-		return nil, errors.New("Invalid access_token")
-	}
-	bearer := fmt.Sprintf("Bearer %s", accessToken)
-	req.Header.Set("Authorization", bearer)
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(res.Status)
-	}
-	return res, nil
-}
-
-// SpotifyPost : make a POST request to Spotify API
-func SpotifyPost(r *http.Request, endpoint string, body io.Reader, accessToken string) (*http.Response, error) {
-	client := &http.Client{Timeout: ClientTimeout}
-	u := fmt.Sprintf("https://api.spotify.com/v1%s", endpoint)
-	req, err := http.NewRequest("POST", u, body)
-	if err != nil {
-		return nil, err
-	}
-	bearer := fmt.Sprintf("Bearer %s", accessToken)
-	req.Header.Set("Authorization", bearer)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if !(res.StatusCode == http.StatusOK || res.StatusCode == http.StatusCreated) {
-		return nil, errors.New(res.Status)
+		SendError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
-	return res, nil
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
 }
 
-// SpotifyAuthPost : make a POST request to Spotify accounts API and receive a token
-func SpotifyAuthPost(r *http.Request, body url.Values, clientID string, clientSecret string) (*Token, error) {
-	client := &http.Client{Timeout: ClientTimeout}
-	u := "https://accounts.spotify.com/api/token"
-	req, err := http.NewRequest("POST", u, bytes.NewBufferString(body.Encode()))
-	if err != nil {
-		return nil, err
-	}
-	bearer := fmt.Sprintf("%s:%s", clientID, clientSecret)
-	secret := base64.StdEncoding.EncodeToString([]byte(bearer))
-	req.Header.Add("Authorization", fmt.Sprintf("Basic %s", secret))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	res, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	if res.StatusCode != http.StatusOK {
-		return nil, errors.New(res.Status)
-	}
-	var tr Token
-	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
-		return nil, err
+// SendSpotifyError : send an error from a Spotify request with the status
+// Spotify answered with mapped onto ours
+func SendSpotifyError(w http.ResponseWriter, err error) {
+	var se *spotify.Error
+	switch {
+	case errors.As(err, &se):
+		code := UpstreamStatus(se)
+		reason := se.Reason
+		if reason == "" {
+			reason = DefaultReason(code)
+		}
+		message := se.Message
+		if message == "" {
+			message = http.StatusText(se.StatusCode)
+		}
+		if se.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(se.RetryAfter.Seconds()))))
+		}
+		SendErrorReason(w, code, reason, message)
+	case errors.Is(err, context.DeadlineExceeded):
+		SendError(w, http.StatusGatewayTimeout, err.Error())
+	default:
+		SendError(w, http.StatusBadGateway, err.Error())
 	}
-	return &tr, nil
 }
 
-// RequestOAuthToken : ask Spotify for an oauth token
-func RequestOAuthToken(r *http.Request, code string, redirectURI string, clientID string, clientSecret string) (*Token, error) {
-	body := url.Values{}
-	body.Set("grant_type", "authorization_code")
-	body.Set("code", code)
-	body.Set("redirect_uri", redirectURI)
-	token, err := SpotifyAuthPost(r, body, clientID, clientSecret)
-	if err != nil {
-		return nil, err
+// SendAuthError : send an error from loading an access token, Spotify errors
+// keep their status and anything else means the user isn't logged in
+func SendAuthError(w http.ResponseWriter, err error) {
+	var se *spotify.Error
+	if errors.As(err, &se) {
+		SendSpotifyError(w, err)
+		return
 	}
-	return token, nil
+	SendError(w, http.StatusUnauthorized, err.Error())
 }
 
-// RequestNewOAuthToken : ask Spotify for a new oauth token
-func RequestNewOAuthToken(r *http.Request, refreshToken string, clientID string, clientSecret string) (*Token, error) {
-	body := url.Values{}
-	body.Set("grant_type", "refresh_token")
-	body.Set("refresh_token", refreshToken)
-	token, err := SpotifyAuthPost(r, body, clientID, clientSecret)
-	if err != nil {
-		return nil, err
-	}
-	return token, nil
+// RequireScope : send a 403 with a needs_scope reason unless the session was
+// granted scope, reporting whether the handler may continue
+func RequireScope(w http.ResponseWriter, s *Session, scope string) bool {
+	if s.HasScope(scope) {
+		return true
+	}
+	msg := fmt.Sprintf("Missing scope %s, log in again with /auth/login?scope=%s", scope, scope)
+	SendErrorReason(w, http.StatusForbidden, "needs_scope", msg)
+	return false
 }
 
-// LoadAccessToken : load acces token from cookies
-func LoadAccessToken(w http.ResponseWriter, r *http.Request, accessTokenCookie CookieID, refreshTokenCookie CookieID, tokenExpiryCookie CookieID, clientID string, clientSecret string) (string, error) {
-	tokenExpiry, err := ReadCookie(r, tokenExpiryCookie)
-	if err != nil {
-		return "", err
-	}
-	expiryTime, err := time.Parse(TimeLayout, tokenExpiry)
-	if err != nil {
-		return "", err
-	}
-	if time.Since(expiryTime) > 0 {
-		refreshToken, err := ReadCookie(r, refreshTokenCookie)
-		if err != nil {
-			return "", err
-		}
-		token, err := RequestNewOAuthToken(r, refreshToken, clientID, clientSecret)
-		if err != nil {
-			return "", err
-		}
-		newTokenExpiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
-		if err := WriteCookie(w, accessTokenCookie, token.AccessToken, newTokenExpiry); err != nil {
-			return "", err
-		}
-		tokenExpiryValue := newTokenExpiry.Format(TimeLayout)
-		yearExpiry := time.Now().Add(365 * 24 * time.Hour)
-		if err := WriteCookie(w, tokenExpiryCookie, tokenExpiryValue, yearExpiry); err != nil {
-			return "", err
-		}
-		return token.AccessToken, nil
-	}
-	accessToken, err := ReadCookie(r, accessTokenCookie)
-	if err != nil {
-		return "", err
-	}
-	return accessToken, nil
+// UpstreamStatus : status to answer with for a Spotify error. Client errors
+// pass through, outages become 503 and anything else from Spotify a 502.
+func UpstreamStatus(se *spotify.Error) int {
+	switch {
+	case errors.Is(se, spotify.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(se, spotify.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case se.StatusCode >= 400 && se.StatusCode < 500:
+		return se.StatusCode
+	case se.StatusCode == http.StatusServiceUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
 }
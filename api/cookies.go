@@ -1,7 +1,12 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -9,23 +14,90 @@ import (
 
 // CookieID : cookie identification
 type CookieID struct {
-	secure *securecookie.SecureCookie
+	codecs []securecookie.Codec
 	name   string
 }
 
-// GenerateCookie : generate a secure cookie
+// CookieKey : base64 encoded hash and block key pair
+type CookieKey struct {
+	HashKey  string `json:"hashKey"`
+	BlockKey string `json:"blockKey"`
+}
+
+// GenerateCookieKey : create a random key pair
+func GenerateCookieKey() CookieKey {
+	return CookieKey{
+		HashKey:  base64.StdEncoding.EncodeToString(GenerateRandomBytes(32)),
+		BlockKey: base64.StdEncoding.EncodeToString(GenerateRandomBytes(32)),
+	}
+}
+
+// ReadCookieKeys : read a key file containing a json array of key pairs, newest first
+func ReadCookieKeys(path string) ([]CookieKey, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []CookieKey
+	if err := json.Unmarshal(file, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// WriteCookieKeys : write key pairs to a key file, newest first
+func WriteCookieKeys(path string, keys []CookieKey) error {
+	b, err := json.MarshalIndent(keys, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// GenerateCookie : generate a secure cookie with random keys
 func GenerateCookie(name string) CookieID {
 	var c CookieID
 	hash := GenerateRandomBytes(16)
 	block := GenerateRandomBytes(16)
-	c.secure = securecookie.New(hash, block)
+	c.codecs = securecookie.CodecsFromPairs(hash, block)
 	c.name = name
 	return c
 }
 
+// NewCookie : create a secure cookie from key pairs. The first pair encodes new
+// cookies, the rest are only used to decode cookies written before a rotation.
+func NewCookie(name string, keys []CookieKey) (CookieID, error) {
+	var c CookieID
+	if len(keys) == 0 {
+		return c, errors.New("No cookie keys")
+	}
+	pairs := make([][]byte, 0, 2*len(keys))
+	for i, k := range keys {
+		hash, err := base64.StdEncoding.DecodeString(k.HashKey)
+		if err != nil {
+			return c, fmt.Errorf("Cookie key %d: invalid hashKey: %v", i, err)
+		}
+		block, err := base64.StdEncoding.DecodeString(k.BlockKey)
+		if err != nil {
+			return c, fmt.Errorf("Cookie key %d: invalid blockKey: %v", i, err)
+		}
+		// securecookie would only report bad lengths on every encode and decode
+		if len(hash) == 0 {
+			return c, fmt.Errorf("Cookie key %d: hashKey is empty", i)
+		}
+		if n := len(block); n != 16 && n != 24 && n != 32 {
+			return c, fmt.Errorf("Cookie key %d: blockKey must be 16, 24 or 32 bytes, got %d", i, n)
+		}
+		pairs = append(pairs, hash, block)
+	}
+	c.codecs = securecookie.CodecsFromPairs(pairs...)
+	c.name = name
+	return c, nil
+}
+
 // WriteCookie : create an http cookie
 func WriteCookie(w http.ResponseWriter, c CookieID, value string, expiry time.Time) error {
-	encoded, err := c.secure.Encode(c.name, value)
+	encoded, err := securecookie.EncodeMulti(c.name, value, c.codecs...)
 	if err != nil {
 		return err
 	}
@@ -48,7 +120,7 @@ func ReadCookie(r *http.Request, c CookieID) (string, error) {
 		return "", err
 	}
 	var dst string
-	decodeErr := c.secure.Decode(c.name, httpCookie.Value, &dst)
+	decodeErr := securecookie.DecodeMulti(c.name, httpCookie.Value, &dst, c.codecs...)
 	if decodeErr != nil {
 		return "", decodeErr
 	}
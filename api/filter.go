@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"micahco/sapi/spotify"
+)
+
+// Oversample : how many times the requested limit to fetch when filters may
+// drop tracks, capped at spotify.MaxRecommendations
+const Oversample = 3
+
+// RecFilter : post-processing applied to recommended tracks
+type RecFilter struct {
+	MaxPerArtist    int
+	ExcludeExplicit bool
+	ExcludePlaylist string
+	DedupeISRC      bool
+	MinDurationMs   *float64
+	MaxDurationMs   *float64
+}
+
+// ParseRecFilter : filter options from the query of r. Duration bounds are
+// the min_duration_ms and max_duration_ms tunables, enforced again here.
+func ParseRecFilter(r *http.Request, v *Validator, req *spotify.RecommendationRequest) RecFilter {
+	f := RecFilter{
+		MaxPerArtist:    v.Int(r, "max_per_artist", 0, 1, spotify.MaxRecommendations),
+		ExcludeExplicit: v.Bool(r, "exclude_explicit"),
+		DedupeISRC:      v.Bool(r, "dedupe_isrc"),
+	}
+	if r.URL.Query().Get("exclude_playlist") != "" {
+		f.ExcludePlaylist = v.ID(r, "exclude_playlist")
+	}
+	if d, ok := req.Tunables["duration_ms"]; ok {
+		f.MinDurationMs = d.Min
+		f.MaxDurationMs = d.Max
+	}
+	return f
+}
+
+// Active : some option can drop tracks
+func (f RecFilter) Active() bool {
+	return f.MaxPerArtist > 0 || f.ExcludeExplicit || f.ExcludePlaylist != "" || f.DedupeISRC ||
+		f.MinDurationMs != nil || f.MaxDurationMs != nil
+}
+
+// OversampledLimit : limit to request so that limit tracks are likely left after filtering
+func (f RecFilter) OversampledLimit(limit int) int {
+	if !f.Active() {
+		return limit
+	}
+	if limit *= Oversample; limit > spotify.MaxRecommendations {
+		limit = spotify.MaxRecommendations
+	}
+	return limit
+}
+
+// Excluded : ids and isrcs of the tracks in the excluded playlist, nil when there is none
+func (f RecFilter) Excluded(ctx context.Context, client *spotify.Client, token string) (map[string]bool, error) {
+	if f.ExcludePlaylist == "" {
+		return nil, nil
+	}
+	items, err := client.PlaylistTracks(token, f.ExcludePlaylist).All(ctx, MaxListItems)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.Track == nil {
+			continue
+		}
+		excluded[item.Track.ID] = true
+		if isrc := item.Track.ExternalIDs.ISRC; isrc != "" {
+			excluded[isrc] = true
+		}
+	}
+	return excluded, nil
+}
+
+// Apply : tracks kept by f, in order, at most limit. excluded holds ids and
+// isrcs of tracks to drop.
+func (f RecFilter) Apply(tracks []spotify.Track, excluded map[string]bool, limit int) []spotify.Track {
+	perArtist := make(map[string]int)
+	isrcs := make(map[string]bool)
+	kept := []spotify.Track{}
+	for _, t := range tracks {
+		if len(kept) >= limit {
+			break
+		}
+		isrc := t.ExternalIDs.ISRC
+		switch {
+		case f.ExcludeExplicit && t.Explicit:
+			continue
+		case excluded[t.ID] || (isrc != "" && excluded[isrc]):
+			continue
+		case f.DedupeISRC && isrc != "" && isrcs[isrc]:
+			continue
+		case f.MinDurationMs != nil && float64(t.DurationMs) < *f.MinDurationMs:
+			continue
+		case f.MaxDurationMs != nil && float64(t.DurationMs) > *f.MaxDurationMs:
+			continue
+		}
+		artist := ""
+		if len(t.Artists) > 0 {
+			artist = t.Artists[0].ID
+		}
+		if f.MaxPerArtist > 0 && perArtist[artist] >= f.MaxPerArtist {
+			continue
+		}
+		perArtist[artist]++
+		if isrc != "" {
+			isrcs[isrc] = true
+		}
+		kept = append(kept, t)
+	}
+	return kept
+}
@@ -1,7 +1,11 @@
 module micahco/sapi
+
 go 1.19
 
 require (
 	github.com/gorilla/securecookie v1.1.1
 	github.com/rs/cors v1.8.2
+	go.etcd.io/bbolt v1.3.7
 )
+
+require golang.org/x/sys v0.4.0 // indirect
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyInProgress : a request with the same key hasn't finished yet
+	ErrIdempotencyInProgress = errors.New("A request with this Idempotency-Key is still in progress")
+	// ErrIdempotencyMismatch : the key was already used for a different request
+	ErrIdempotencyMismatch = errors.New("Idempotency-Key was already used with a different request")
+)
+
+const (
+	// IdempotencyClaimTimeout : how long a key stays in progress before a
+	// request whose handler never returned stops blocking it
+	IdempotencyClaimTimeout = 5 * time.Minute
+	// IdempotencySweepInterval : how often expired entries are deleted
+	IdempotencySweepInterval = 10 * time.Minute
+	// MaxIdempotentBody : largest request body read for fingerprinting
+	MaxIdempotentBody = 1 << 20
+)
+
+// StoredResponse : response recorded for an idempotency key
+type StoredResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore : responses of finished requests by key, kept for ttl
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	fingerprint string
+	response    *StoredResponse
+	expires     time.Time
+}
+
+// NewIdempotencyStore : create a store keeping responses for ttl
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{ttl: ttl, entries: make(map[string]*idempotencyEntry)}
+}
+
+// Begin : claim key for a request identified by fingerprint. When key already
+// finished its response is returned, when it's still running or belongs to a
+// different request an error.
+func (s *IdempotencyStore) Begin(key string, fingerprint string) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if e, found := s.entries[key]; found && now.After(e.expires) {
+		delete(s.entries, key)
+	}
+	if e, found := s.entries[key]; found {
+		if e.fingerprint != fingerprint {
+			return nil, ErrIdempotencyMismatch
+		}
+		if e.response == nil {
+			return nil, ErrIdempotencyInProgress
+		}
+		return e.response, nil
+	}
+	s.entries[key] = &idempotencyEntry{fingerprint: fingerprint, expires: now.Add(IdempotencyClaimTimeout)}
+	return nil, nil
+}
+
+// Finish : store the response for a key claimed with Begin
+func (s *IdempotencyStore) Finish(key string, res *StoredResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, found := s.entries[key]; found {
+		e.response = res
+		e.expires = time.Now().Add(s.ttl)
+	}
+}
+
+// Abort : release a key claimed with Begin so the request can be retried
+func (s *IdempotencyStore) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// Sweep : delete expired entries every interval, for as long as the process runs
+func (s *IdempotencyStore) Sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.deleteExpired(time.Now())
+	}
+}
+
+func (s *IdempotencyStore) deleteExpired(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+// Idempotent : middleware for mutating handlers. A POST, PUT, PATCH or DELETE
+// carrying an Idempotency-Key header runs once per session and key, repeats
+// get the first response replayed.
+func Idempotent(store *IdempotencyStore, sessions *SessionManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Idempotency-Key")
+		if header == "" || !mutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		session, err := sessions.Load(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxIdempotentBody))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			SendError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must be at most %d bytes", MaxIdempotentBody))
+			return
+		}
+		if err != nil {
+			SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := session.ID + " " + header
+		previous, err := store.Begin(key, fingerprint(r, body))
+		switch {
+		case errors.Is(err, ErrIdempotencyMismatch):
+			SendErrorReason(w, http.StatusConflict, "idempotency_key_reused", err.Error())
+			return
+		case err != nil:
+			SendErrorReason(w, http.StatusConflict, "idempotency_in_progress", err.Error())
+			return
+		case previous != nil:
+			for k, v := range previous.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(previous.Status)
+			w.Write(previous.Body)
+			return
+		}
+
+		// release the key if the handler panics or fails in a way that may go away
+		finished := false
+		defer func() {
+			if !finished {
+				store.Abort(key)
+			}
+		}()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status >= 500 || rec.status == http.StatusTooManyRequests || rec.status == http.StatusConflict {
+			return
+		}
+		finished = true
+		store.Finish(key, &StoredResponse{
+			Status: rec.status,
+			Header: w.Header().Clone(),
+			Body:   rec.body.Bytes(),
+		})
+	})
+}
+
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// fingerprint : hash of what makes two requests the same request
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder : writes through to the client while keeping a copy
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotent(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          string
+		status       int    // status the handler answers with
+		first        string // body of the first request
+		second       string // body of the repeat
+		inProgress   bool   // repeat while the first request is still running
+		wantStatus   int
+		wantReason   string
+		wantReplayed bool
+		wantCalls    int
+	}{
+		{name: "replays first response", key: "k", status: http.StatusCreated, first: `{"a":1}`, second: `{"a":1}`,
+			wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 1},
+		{name: "key reused with another body", key: "k", status: http.StatusCreated, first: `{"a":1}`, second: `{"a":2}`,
+			wantStatus: http.StatusConflict, wantReason: "idempotency_key_reused", wantCalls: 1},
+		{name: "key still in progress", key: "k", status: http.StatusCreated, first: `{"a":1}`, second: `{"a":1}`, inProgress: true,
+			wantStatus: http.StatusConflict, wantReason: "idempotency_in_progress", wantCalls: 1},
+		{name: "5xx is aborted", key: "k", status: http.StatusBadGateway, first: `{"a":1}`, second: `{"a":1}`,
+			wantStatus: http.StatusBadGateway, wantCalls: 2},
+		{name: "429 is aborted", key: "k", status: http.StatusTooManyRequests, first: `{"a":1}`, second: `{"a":1}`,
+			wantStatus: http.StatusTooManyRequests, wantCalls: 2},
+		{name: "no key runs every time", status: http.StatusCreated, first: `{"a":1}`, second: `{"a":1}`,
+			wantStatus: http.StatusCreated, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := NewSessionManager(NewMemorySessionStore(), GenerateCookie("session"), nil, "", "")
+			start := httptest.NewRecorder()
+			if err := sessions.Start(start, &Session{}); err != nil {
+				t.Fatal(err)
+			}
+			cookie := start.Result().Cookies()[0]
+
+			var mu sync.Mutex
+			calls := 0
+			started := make(chan struct{})
+			release := make(chan struct{})
+			handler := Idempotent(NewIdempotencyStore(time.Hour), sessions, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				calls++
+				n := calls
+				mu.Unlock()
+				if tt.inProgress && n == 1 {
+					close(started)
+					<-release
+				}
+				SendJSON(w, tt.status, map[string]int{"call": n})
+			}))
+			send := func(body string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPost, "/playlist", strings.NewReader(body))
+				r.AddCookie(cookie)
+				if tt.key != "" {
+					r.Header.Set("Idempotency-Key", tt.key)
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				return w
+			}
+
+			var first *httptest.ResponseRecorder
+			done := make(chan struct{})
+			go func() {
+				first = send(tt.first)
+				close(done)
+			}()
+			if tt.inProgress {
+				<-started
+			} else {
+				<-done
+			}
+			second := send(tt.second)
+			if tt.inProgress {
+				close(release)
+				<-done
+			}
+
+			if second.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", second.Code, tt.wantStatus)
+			}
+			if tt.wantReason != "" {
+				var e ErrorResponse
+				if err := json.Unmarshal(second.Body.Bytes(), &e); err != nil || e.Reason != tt.wantReason {
+					t.Errorf("reason = %q (%v), want %q", e.Reason, err, tt.wantReason)
+				}
+			}
+			replayed := second.Header().Get("Idempotent-Replayed") == "true"
+			if replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if tt.wantReplayed && second.Body.String() != first.Body.String() {
+				t.Errorf("replayed body = %s, want %s", second.Body, first.Body)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
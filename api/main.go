@@ -4,111 +4,196 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"expvar"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/rs/cors"
+	"micahco/sapi/spotify"
 )
 
 const (
 	// ClientTimeout : timeout for http.Client
 	ClientTimeout = time.Second * 10
-	// TimeLayout : format for converting time to and from string
-	TimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+	// DefaultDebugAddr : address of the /debug/vars listener, "off" in config disables it
+	DefaultDebugAddr = "localhost:6060"
+	// MaxListItems : most items collected when paging through a list endpoint
+	MaxListItems = 1000
 )
 
 func main() {
+	// subcommands
+	if len(os.Args) > 1 && os.Args[1] == "genkey" {
+		genKey(os.Args[2:])
+		return
+	}
+
 	// config
 	config := getConfig("./config.json")
 	clientID := config.SpotifyClientID
 	clientSecret := config.SpotifyClientSecret
-	scope := []string{
-		"playlist-modify-public",
+	// public (PKCE) clients never send the secret for user tokens
+	userSecret := clientSecret
+	if config.PKCE {
+		userSecret = ""
+	}
+	scope := config.Scopes
+	if len(scope) == 0 {
+		// user-read-private lets /me share the user's country for market resolution
+		scope = []string{"playlist-modify-public", "user-read-private"}
+	}
+
+	// sessions
+	store, err := NewSessionStore(config.SessionStore, config.SessionPath)
+	if err != nil {
+		panic(err)
 	}
+	sessionCookie := getSessionCookie(config)
+	client := spotify.NewClient(&http.Client{Timeout: ClientTimeout})
+	sessions := NewSessionManager(store, sessionCookie, client, clientID, userSecret)
+	go sessions.Sweep(SessionSweepInterval)
 
-	// cookies
-	authStateCookie := GenerateCookie("auth_state")
-	accessTokenCookie := GenerateCookie("access_token")
-	refreshTokenCookie := GenerateCookie("refresh_token")
-	tokenExpiryCookie := GenerateCookie("token_expiry")
+	// app token for logged out catalog reads, client credentials need the secret
+	var appToken *spotify.AppToken
+	if clientSecret != "" {
+		appToken = spotify.NewAppToken(client, clientID, clientSecret)
+	}
+
+	// response cache
+	cache, err := NewCache(config.Cache, config.CachePath, config.CacheSize)
+	if err != nil {
+		panic(err)
+	}
+	cacheTTLs, err := ParseCacheTTLs(config.CacheTTLs)
+	if err != nil {
+		panic(err)
+	}
+	responseCache := NewResponseCache(cache, client, cacheTTLs)
+
+	// idempotency keys for mutating endpoints
+	idempotencyTTL := 24 * time.Hour
+	if config.IdempotencyTTL != "" {
+		if idempotencyTTL, err = time.ParseDuration(config.IdempotencyTTL); err != nil {
+			panic(err)
+		}
+	}
+	idempotency := NewIdempotencyStore(idempotencyTTL)
+	go idempotency.Sweep(IdempotencySweepInterval)
 
 	// router
 	mux := http.NewServeMux()
 	mux.Handle("/auth/login", &LoginHandler{
-		clientID:        clientID,
-		redirectURI:     config.RedirectURI,
-		scope:           scope,
-		authStateCookie: authStateCookie,
+		clientID:       clientID,
+		redirectURI:    config.RedirectURI,
+		scope:          scope,
+		optionalScopes: config.OptionalScopes,
+		pkce:           config.PKCE,
+		sessions:       sessions,
 	})
 	mux.Handle("/auth/logout", &LogoutHandler{
-		cookies: []CookieID{
-			authStateCookie,
-			accessTokenCookie,
-			refreshTokenCookie,
-			tokenExpiryCookie,
-		},
-		appURL: config.AppURL,
+		sessions: sessions,
+		appURL:   config.AppURL,
 	})
 	mux.Handle("/auth/callback", &CallbackHandler{
-		authStateCookie:    authStateCookie,
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
-		redirectURI:        config.RedirectURI,
-		appURL:             config.AppURL,
-	})
-	mux.Handle("/auth", &AuthHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+		sessions:     sessions,
+		client:       client,
+		clientID:     clientID,
+		clientSecret: userSecret,
+		redirectURI:  config.RedirectURI,
+		appURL:       config.AppURL,
 	})
+	mux.Handle("/auth", &AuthHandler{sessions: sessions})
+	market := strings.ToUpper(config.Market)
+	if market == "" {
+		market = DefaultMarket
+	}
+	if !ValidMarket(market) {
+		panic(fmt.Sprintf("Invalid market %q in config", config.Market))
+	}
+	recLimit := config.RecommendationLimit
+	if recLimit == 0 {
+		recLimit = DefaultRecommendationLimit
+	}
+	if recLimit < 1 || recLimit > spotify.MaxRecommendations {
+		panic(fmt.Sprintf("recommendationLimit must be from 1 to %d", spotify.MaxRecommendations))
+	}
+	maxSearchResults := config.MaxSearchResults
+	if maxSearchResults <= 0 {
+		maxSearchResults = 200
+	}
+	if maxSearchResults > MaxSearchResults {
+		fmt.Printf("maxSearchResults %d is more than Spotify pages to, using %d\n", maxSearchResults, MaxSearchResults)
+		maxSearchResults = MaxSearchResults
+	}
 	mux.Handle("/search", &SearchHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+		sessions:   sessions,
+		client:     client,
+		cache:      responseCache,
+		app:        appToken,
+		market:     market,
+		maxResults: maxSearchResults,
 	})
 	mux.Handle("/artist", &ArtistHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+		sessions: sessions,
+		client:   client,
+		cache:    responseCache,
+		app:      appToken,
 	})
 	mux.Handle("/track", &TrackHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+		sessions: sessions,
+		client:   client,
+		cache:    responseCache,
+		app:      appToken,
 	})
+	recommender, err := NewRecommender(config.Recommender, client)
+	if err != nil {
+		panic(err)
+	}
 	mux.Handle("/rec", &RecHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+		sessions:    sessions,
+		client:      client,
+		recommender: recommender,
+		app:         appToken,
+		market:      market,
+		limit:       recLimit,
 	})
-	mux.Handle("/playlist", &PlaylistHandler{
-		accessTokenCookie:  accessTokenCookie,
-		refreshTokenCookie: refreshTokenCookie,
-		tokenExpiryCookie:  tokenExpiryCookie,
-		clientID:           clientID,
-		clientSecret:       clientSecret,
+	mux.Handle("/playlist", Idempotent(idempotency, sessions, &PlaylistHandler{
+		sessions: sessions,
+		client:   client,
+	}))
+	mux.Handle("/playlists", &PlaylistsHandler{
+		sessions: sessions,
+		client:   client,
 	})
+	// expvar exposes the command line and memstats, so it gets its own
+	// listener, on localhost unless configured otherwise
+	debugAddr := config.DebugAddr
+	if debugAddr == "" {
+		debugAddr = DefaultDebugAddr
+	}
+	if debugAddr != "off" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			fmt.Printf("debug listener: http://%s/debug/vars\n", debugAddr)
+			if err := http.ListenAndServe(debugAddr, debug); err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
 
 	// middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{config.AppURL},
 		AllowCredentials: true,
-		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Idempotency-Key"},
+		ExposedHeaders:   []string{"X-Cache", "Retry-After", "Idempotent-Replayed"},
 	})
 	app := c.Handler(mux)
 
@@ -147,12 +232,29 @@ func GenerateRandomBytes(n int) []byte {
 }
 
 type config struct {
-	APIURL              string `json:"apiURL"`
-	AppURL              string `json:"appURL"`
-	RedirectURI         string `json:"redirectURI"`
-	SpotifyClientID     string `json:"spotifyClientID"`
-	SpotifyClientSecret string `json:"spotifyClientSecret"`
-	Production          bool   `json:"production"`
+	APIURL              string            `json:"apiURL"`
+	AppURL              string            `json:"appURL"`
+	RedirectURI         string            `json:"redirectURI"`
+	SpotifyClientID     string            `json:"spotifyClientID"`
+	SpotifyClientSecret string            `json:"spotifyClientSecret"`
+	Production          bool              `json:"production"`
+	PKCE                bool              `json:"pkce"`
+	Scopes              []string          `json:"scopes"`
+	OptionalScopes      []string          `json:"optionalScopes"`
+	IdempotencyTTL      string            `json:"idempotencyTTL"`
+	MaxSearchResults    int               `json:"maxSearchResults"`
+	Market              string            `json:"market"`
+	RecommendationLimit int               `json:"recommendationLimit"`
+	Recommender         string            `json:"recommender"`
+	DebugAddr           string            `json:"debugAddr"`
+	SessionStore        string            `json:"sessionStore"`
+	SessionPath         string            `json:"sessionPath"`
+	CookieKeys          []CookieKey       `json:"cookieKeys"`
+	CookieKeyFile       string            `json:"cookieKeyFile"`
+	Cache               string            `json:"cache"`
+	CachePath           string            `json:"cachePath"`
+	CacheSize           int               `json:"cacheSize"`
+	CacheTTLs           map[string]string `json:"cacheTTLs"`
 }
 
 func getConfig(path string) config {
@@ -164,3 +266,77 @@ func getConfig(path string) config {
 	json.Unmarshal(file, &c)
 	return c
 }
+
+// getSessionCookie : session cookie keyed from config or the key file, random keys otherwise
+func getSessionCookie(c config) CookieID {
+	keys := c.CookieKeys
+	if len(keys) == 0 && c.CookieKeyFile != "" {
+		k, err := ReadCookieKeys(c.CookieKeyFile)
+		if err != nil {
+			panic(err)
+		}
+		keys = k
+	}
+	if len(keys) == 0 {
+		fmt.Println("no cookie keys configured: sessions will not survive a restart")
+		return GenerateCookie("session")
+	}
+	cookie, err := NewCookie("session", keys)
+	if err != nil {
+		panic(err)
+	}
+	return cookie
+}
+
+// genKey : `sapi genkey` prints a new key pair, `sapi genkey -file keys.json`
+// rotates it into a key file keeping the previous pairs for decoding
+func genKey(args []string) {
+	fs := flag.NewFlagSet("genkey", flag.ExitOnError)
+	file := fs.String("file", "", "prepend the new key pair to this key file")
+	keep := fs.Int("keep", 1, "number of previous key pairs to keep in the key file")
+	fs.Parse(args)
+
+	key := GenerateCookieKey()
+	if *file == "" {
+		out, err := json.MarshalIndent(key, "", "\t")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	old, err := ReadCookieKeys(*file)
+	if err != nil && !os.IsNotExist(err) {
+		panic(err)
+	}
+	if len(old) > *keep {
+		old = old[:*keep]
+	}
+	if err := WriteCookieKeys(*file, append([]CookieKey{key}, old...)); err != nil {
+		panic(err)
+	}
+	fmt.Printf("rotated cookie keys in %s (%d previous kept)\n", *file, len(old))
+}
+
+// containsString : s is in list
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueStrings : list without duplicates, keeping first occurrences in order
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	out := list[:0]
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"syscall"
+	"time"
+
+	"micahco/sapi/spotify"
+)
+
+// BatchRetries : extra attempts for a batch of tracks Spotify refused without
+// applying it (rate limited after the client's own retries, or not reached at all)
+const BatchRetries = 2
+
+var trackURIPattern = regexp.MustCompile(`^spotify:(track|episode):[0-9A-Za-z]{22}$`)
+
+// ValidTrackURI : uri is a spotify track or episode uri
+func ValidTrackURI(uri string) bool {
+	return trackURIPattern.MatchString(uri)
+}
+
+// InvalidTrackURIs : uris that aren't valid track uris
+func InvalidTrackURIs(uris []string) []string {
+	var invalid []string
+	for _, uri := range uris {
+		if !ValidTrackURI(uri) {
+			invalid = append(invalid, uri)
+		}
+	}
+	return invalid
+}
+
+// BatchResult : outcome of changing playlist tracks in batches
+type BatchResult struct {
+	Succeeded  int
+	FailedURIs []string
+	Err        error
+}
+
+// inBatches : call fn with uris in order, 100 at a time. done is the number
+// of uris that succeeded before the batch. Only batches Spotify is known not
+// to have applied are sent again, after a backoff from retry, so a retried add
+// can't insert the same tracks twice.
+func inBatches(ctx context.Context, retry spotify.RetryPolicy, uris []string, fn func(batch []string, done int) error) BatchResult {
+	var res BatchResult
+	for i := 0; i < len(uris); i += spotify.MaxTracksPerRequest {
+		end := i + spotify.MaxTracksPerRequest
+		if end > len(uris) {
+			end = len(uris)
+		}
+		batch := uris[i:end]
+		var err error
+		for attempt := 0; ; attempt++ {
+			err = fn(batch, res.Succeeded)
+			if err == nil || !unapplied(err) || attempt >= BatchRetries {
+				break
+			}
+			if sleep(ctx, retryDelay(retry, attempt, err)) != nil {
+				break
+			}
+		}
+		if err != nil {
+			res.FailedURIs = append(res.FailedURIs, batch...)
+			res.Err = err
+			continue
+		}
+		res.Succeeded += len(batch)
+	}
+	return res
+}
+
+// AddTracksInBatches : insert uris into a playlist in order starting at
+// position start, or appended when start is negative. Each batch is placed
+// after the tracks added so far, so a failed batch doesn't shift later ones
+// out of order.
+func AddTracksInBatches(ctx context.Context, client *spotify.Client, token string, playlistID string, start int, uris []string) BatchResult {
+	return inBatches(ctx, client.Retry, uris, func(batch []string, done int) error {
+		position := -1
+		if start >= 0 {
+			position = start + done
+		}
+		_, err := client.AddTracksAt(ctx, token, playlistID, batch, position)
+		return err
+	})
+}
+
+// RemoveTracksInBatches : remove every occurrence of uris from a playlist
+func RemoveTracksInBatches(ctx context.Context, client *spotify.Client, token string, playlistID string, uris []string) BatchResult {
+	return inBatches(ctx, client.Retry, uris, func(batch []string, done int) error {
+		_, err := client.RemoveTracks(ctx, token, playlistID, batch)
+		return err
+	})
+}
+
+// unapplied : err means Spotify didn't act on the request, so it's safe to
+// send again. Anything else (5xx, timeouts, dropped connections) may have
+// been applied.
+func unapplied(err error) bool {
+	var se *spotify.Error
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusTooManyRequests
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryDelay : backoff for attempt, at least the Retry-After Spotify sent
+func retryDelay(retry spotify.RetryPolicy, attempt int, err error) time.Duration {
+	d := retry.Backoff(attempt)
+	var se *spotify.Error
+	if errors.As(err, &se) && se.RetryAfter > d {
+		d = se.RetryAfter
+	}
+	return d
+}
+
+// sleep : wait d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// RollbackPlaylist : unfollow (delete) a playlist whose creation couldn't be
+// completed. Runs detached from the request so a cancelled request still
+// cleans up after itself.
+func RollbackPlaylist(client *spotify.Client, token string, playlistID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ClientTimeout)
+	defer cancel()
+	return client.UnfollowPlaylist(ctx, token, playlistID)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"micahco/sapi/spotify"
+)
+
+// DefaultRecommendationLimit : tracks /rec returns when neither the request nor the config sets a limit
+const DefaultRecommendationLimit = 30
+
+var genrePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ParseRecommendationRequest : seeds, limit and tunable attributes from the
+// query of r, recording every invalid parameter in v. Other parameters are ignored.
+func ParseRecommendationRequest(r *http.Request, v *Validator, defaultLimit int) *spotify.RecommendationRequest {
+	req := &spotify.RecommendationRequest{
+		SeedArtists: v.IDList(r, "seed_artists"),
+		SeedTracks:  v.IDList(r, "seed_tracks"),
+		SeedGenres:  listParam(r, "seed_genres"),
+		Limit:       v.Int(r, "limit", defaultLimit, 1, spotify.MaxRecommendations),
+		Tunables:    make(map[string]spotify.Tunable),
+	}
+	for _, g := range req.SeedGenres {
+		if !genrePattern.MatchString(g) {
+			v.Fail("seed_genres", "Invalid genre %q", g)
+			break
+		}
+	}
+	switch n := req.Seeds(); {
+	case n == 0:
+		v.Fail("seeds", "At least one of seed_artists, seed_tracks or seed_genres is required")
+	case n > spotify.MaxSeeds:
+		v.Fail("seeds", "At most %d seeds combined, got %d", spotify.MaxSeeds, n)
+	}
+	for _, a := range spotify.Attributes {
+		t := spotify.Tunable{
+			Min:    v.Attribute(r, "min_"+a.Name, a),
+			Max:    v.Attribute(r, "max_"+a.Name, a),
+			Target: v.Attribute(r, "target_"+a.Name, a),
+		}
+		if t.Min != nil && t.Max != nil && *t.Min > *t.Max {
+			v.Fail("min_"+a.Name, "min_%s can't be more than max_%s", a.Name, a.Name)
+		}
+		if t.Target != nil && ((t.Min != nil && *t.Target < *t.Min) || (t.Max != nil && *t.Target > *t.Max)) {
+			v.Fail("target_"+a.Name, "target_%s must be between min_%s and max_%s", a.Name, a.Name, a.Name)
+		}
+		if t.Min != nil || t.Max != nil || t.Target != nil {
+			req.Tunables[a.Name] = t
+		}
+	}
+	return req
+}
+
+// listParam : comma-separated parameter without empty values
+func listParam(r *http.Request, name string) []string {
+	var list []string
+	for _, s := range strings.Split(r.URL.Query().Get(name), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// IDList : comma-separated Spotify ids, empty when absent
+func (v *Validator) IDList(r *http.Request, name string) []string {
+	ids := listParam(r, name)
+	for _, id := range ids {
+		if !ValidSpotifyID(id) {
+			v.Fail(name, "%q isn't a 22 character base62 Spotify id", id)
+			break
+		}
+	}
+	return uniqueStrings(ids)
+}
+
+// Attribute : value for attribute a, nil when absent
+func (v *Validator) Attribute(r *http.Request, name string, a spotify.Attribute) *float64 {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || f < a.Min || f > a.Max || (a.Integer && f != math.Trunc(f)) {
+		kind := "a number"
+		if a.Integer {
+			kind = "a whole number"
+		}
+		v.Fail(name, "%s must be %s from %s to %s", name, kind, formatFloat(a.Min), formatFloat(a.Max))
+		return nil
+	}
+	return &f
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
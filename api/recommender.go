@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+
+	"micahco/sapi/spotify"
+)
+
+const (
+	// RelatedArtistsPerSeed : related artists the local recommender adds to the pool for each seed artist
+	RelatedArtistsPerSeed = 5
+	// ArtistsPerGenre : artists the local recommender searches for each seed genre
+	ArtistsPerGenre = 5
+	// maxConcurrentFetches : upstream calls the local recommender makes at once
+	maxConcurrentFetches = 4
+)
+
+// Recommender : source of track recommendations for a request
+type Recommender interface {
+	Recommend(ctx context.Context, token string, req *spotify.RecommendationRequest) (*spotify.Recommendations, error)
+}
+
+// NewRecommender : create the recommender selected by kind ("spotify", "local"
+// or "fallback" for spotify falling back to local)
+func NewRecommender(kind string, client *spotify.Client) (Recommender, error) {
+	switch kind {
+	case "", "spotify":
+		return &SpotifyRecommender{client: client}, nil
+	case "local":
+		return &LocalRecommender{client: client}, nil
+	case "fallback":
+		return &FallbackRecommender{
+			primary:  &SpotifyRecommender{client: client},
+			fallback: &LocalRecommender{client: client},
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown recommender %q", kind)
+	}
+}
+
+// SpotifyRecommender : proxies Spotify's recommendations endpoint
+type SpotifyRecommender struct {
+	client *spotify.Client
+}
+
+// Recommend : fetch recommendations from Spotify
+func (s *SpotifyRecommender) Recommend(ctx context.Context, token string, req *spotify.RecommendationRequest) (*spotify.Recommendations, error) {
+	return s.client.Recommendations(ctx, token, req)
+}
+
+// FallbackRecommender : primary, or fallback when primary is unavailable
+type FallbackRecommender struct {
+	primary  Recommender
+	fallback Recommender
+}
+
+// Recommend : recommendations from primary, trying fallback if Spotify
+// refuses or can't serve them
+func (f *FallbackRecommender) Recommend(ctx context.Context, token string, req *spotify.RecommendationRequest) (*spotify.Recommendations, error) {
+	rec, err := f.primary.Recommend(ctx, token, req)
+	if err != nil && unavailable(err) {
+		return f.fallback.Recommend(ctx, token, req)
+	}
+	return rec, err
+}
+
+// unavailable : err means the endpoint is restricted, gone or down rather
+// than that the request or token was bad
+func unavailable(err error) bool {
+	var se *spotify.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	switch {
+	case errors.Is(se, spotify.ErrRateLimited):
+		return false
+	case errors.Is(se, spotify.ErrUnavailable):
+		return true
+	}
+	switch se.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return se.StatusCode >= 500
+}
+
+// LocalRecommender : recommends from the top tracks of the seed artists and
+// their related artists, ranked by how close they are to the requested targets
+type LocalRecommender struct {
+	client *spotify.Client
+}
+
+// Recommend : build, filter and rank candidates for req
+func (l *LocalRecommender) Recommend(ctx context.Context, token string, req *spotify.RecommendationRequest) (*spotify.Recommendations, error) {
+	market := req.Market
+	if market == "" {
+		market = DefaultMarket
+	}
+	seeds, artists, exclude, err := l.seedArtists(ctx, token, req)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := l.relatedPool(ctx, token, artists)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := l.topTracks(ctx, token, pool, market, exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var features map[string]*spotify.AudioFeatures
+	if needsFeatures(req.Tunables) {
+		features, err = l.client.GetAudioFeatures(ctx, token, trackIDs(candidates))
+		// without audio features rank by the attributes tracks carry themselves
+		if err != nil && !unavailable(err) {
+			return nil, err
+		}
+	}
+	ranked := rankTracks(candidates, features, req.Tunables)
+	for i := range seeds {
+		seeds[i].InitialPoolSize = len(candidates)
+		seeds[i].AfterFilteringSize = len(ranked)
+		seeds[i].AfterRelinkingSize = len(ranked)
+	}
+	if len(ranked) > req.Limit {
+		ranked = ranked[:req.Limit]
+	}
+	return &spotify.Recommendations{Seeds: seeds, Tracks: ranked}, nil
+}
+
+// seedArtists : seeds as reported back, artists to build candidates from and
+// seed track ids that mustn't be recommended
+func (l *LocalRecommender) seedArtists(ctx context.Context, token string, req *spotify.RecommendationRequest) ([]spotify.RecommendationSeed, []string, map[string]bool, error) {
+	var seeds []spotify.RecommendationSeed
+	artists := append([]string{}, req.SeedArtists...)
+	exclude := make(map[string]bool)
+	for _, id := range req.SeedArtists {
+		seeds = append(seeds, spotify.RecommendationSeed{ID: id, Type: "ARTIST"})
+	}
+	for _, id := range req.SeedTracks {
+		seeds = append(seeds, spotify.RecommendationSeed{ID: id, Type: "TRACK"})
+		exclude[id] = true
+		track, err := l.client.GetTrack(ctx, token, id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, a := range track.Artists {
+			artists = append(artists, a.ID)
+		}
+	}
+	for _, genre := range req.SeedGenres {
+		seeds = append(seeds, spotify.RecommendationSeed{ID: genre, Type: "GENRE"})
+		query := fmt.Sprintf("genre:%q", genre)
+		res, err := l.client.Search(ctx, token, query, []string{"artist"}, spotify.SearchOptions{Limit: ArtistsPerGenre, Market: req.Market})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if res.Artists != nil {
+			for _, a := range res.Artists.Items {
+				artists = append(artists, a.ID)
+			}
+		}
+	}
+	return seeds, uniqueStrings(artists), exclude, nil
+}
+
+// relatedPool : artists plus up to RelatedArtistsPerSeed related artists each
+func (l *LocalRecommender) relatedPool(ctx context.Context, token string, artists []string) ([]string, error) {
+	related := make([][]string, len(artists))
+	err := fetchEach(len(artists), func(i int) error {
+		list, err := l.client.RelatedArtists(ctx, token, artists[i])
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(list) && j < RelatedArtistsPerSeed; j++ {
+			related[i] = append(related[i], list[j].ID)
+		}
+		return nil
+	})
+	if err != nil && !unavailable(err) {
+		return nil, err
+	}
+	pool := append([]string{}, artists...)
+	for _, ids := range related {
+		pool = append(pool, ids...)
+	}
+	return uniqueStrings(pool), nil
+}
+
+// topTracks : top tracks of every artist in pool, without duplicates or excluded ids
+func (l *LocalRecommender) topTracks(ctx context.Context, token string, pool []string, market string, exclude map[string]bool) ([]spotify.Track, error) {
+	top := make([][]spotify.Track, len(pool))
+	err := fetchEach(len(pool), func(i int) error {
+		tracks, err := l.client.ArtistTopTracks(ctx, token, pool[i], market)
+		top[i] = tracks
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var candidates []spotify.Track
+	for _, tracks := range top {
+		for _, t := range tracks {
+			if seen[t.ID] || exclude[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+			candidates = append(candidates, t)
+		}
+	}
+	return candidates, nil
+}
+
+// fetchEach : call fn for 0..n-1, at most maxConcurrentFetches at once,
+// returning the first error
+func fetchEach(n int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, maxConcurrentFetches)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(i); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func trackIDs(tracks []spotify.Track) []string {
+	ids := make([]string, len(tracks))
+	for i, t := range tracks {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+// needsFeatures : some tunable is an audio feature rather than a track field
+func needsFeatures(tunables map[string]spotify.Tunable) bool {
+	for name := range tunables {
+		if name != "popularity" && name != "duration_ms" {
+			return true
+		}
+	}
+	return false
+}
+
+// attributeValue : value of the named attribute for t, from its audio
+// features when it isn't a field of the track itself
+func attributeValue(t *spotify.Track, f *spotify.AudioFeatures, name string) (float64, bool) {
+	switch name {
+	case "popularity":
+		return float64(t.Popularity), true
+	case "duration_ms":
+		return float64(t.DurationMs), true
+	}
+	if f == nil {
+		return 0, false
+	}
+	return f.Value(name)
+}
+
+// TargetDistance : root mean square distance of t from the targets in
+// tunables, each attribute scaled by its range. False when there are no
+// targets or the value of a targeted attribute isn't known, so tracks are
+// never compared on different sets of attributes.
+func TargetDistance(t *spotify.Track, f *spotify.AudioFeatures, tunables map[string]spotify.Tunable) (float64, bool) {
+	var sum float64
+	n := 0
+	for _, a := range spotify.Attributes {
+		tun, ok := tunables[a.Name]
+		if !ok || tun.Target == nil {
+			continue
+		}
+		v, ok := attributeValue(t, f, a.Name)
+		if !ok {
+			return 0, false
+		}
+		d := (v - *tun.Target) / (a.Max - a.Min)
+		sum += d * d
+		n++
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return math.Sqrt(sum / float64(n)), true
+}
+
+// WithinBounds : t is within every min and max in tunables, attributes
+// without a known value are skipped
+func WithinBounds(t *spotify.Track, f *spotify.AudioFeatures, tunables map[string]spotify.Tunable) bool {
+	for name, tun := range tunables {
+		v, ok := attributeValue(t, f, name)
+		if !ok {
+			continue
+		}
+		if (tun.Min != nil && v < *tun.Min) || (tun.Max != nil && v > *tun.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// rankTracks : tracks within every bound, closest to the targets first.
+// Tracks whose distance can't be measured follow the scored ones, and ties
+// go to the more popular track.
+func rankTracks(tracks []spotify.Track, features map[string]*spotify.AudioFeatures, tunables map[string]spotify.Tunable) []spotify.Track {
+	type scored struct {
+		track    spotify.Track
+		distance float64
+		known    bool
+	}
+	var list []scored
+	for _, t := range tracks {
+		f := features[t.ID]
+		if !WithinBounds(&t, f, tunables) {
+			continue
+		}
+		d, ok := TargetDistance(&t, f, tunables)
+		list = append(list, scored{track: t, distance: d, known: ok})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].known != list[j].known {
+			return list[i].known
+		}
+		if list[i].distance != list[j].distance {
+			return list[i].distance < list[j].distance
+		}
+		return list[i].track.Popularity > list[j].track.Popularity
+	})
+	ranked := make([]spotify.Track, len(list))
+	for i, s := range list {
+		ranked[i] = s.track
+	}
+	return ranked
+}
@@ -1,18 +1,13 @@
 package main
 
-// Token : oauth2 token
-type Token struct {
-	AccessToken  string `json:"access_token"`
-	TokenType    string `json:"token_type"`
-	Scope        string `json:"scope"`
-	ExpiresIn    int    `json:"expires_in"`
-	RefreshToken string `json:"refresh_token"`
-}
+import "micahco/sapi/spotify"
 
 // ErrorResponse : http error response
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int          `json:"code"`
+	Reason  string       `json:"reason"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
 }
 
 // AuthStatus : spotify authentication status
@@ -20,28 +15,87 @@ type AuthStatus struct {
 	Authenticated bool `json:"authenticated"`
 }
 
-// User : /me spotify response
-type User struct {
-	ID string `json:"id"`
+// PlaylistTracksBody : post tracks to playlist, with optional playlist settings
+type PlaylistTracksBody struct {
+	URIS          []string `json:"uris"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Public        *bool    `json:"public"`
+	Collaborative bool     `json:"collaborative"`
+	Order         string   `json:"order"`
 }
 
-// PlaylistBody : post body for spotify playlist
-type PlaylistBody struct {
-	Name string `json:"name"`
+// PlaylistReturnJSON : return data for frontend
+type PlaylistReturnJSON struct {
+	ID            string   `json:"id"`
+	Username      string   `json:"username"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Public        bool     `json:"public"`
+	Collaborative bool     `json:"collaborative"`
+	TracksAdded   int      `json:"tracksAdded"`
+	TracksFailed  int      `json:"tracksFailed"`
+	FailedURIs    []string `json:"failedURIs,omitempty"`
+	Order         string   `json:"order,omitempty"`
 }
 
-// PlaylistResponse : spotify playlist
-type PlaylistResponse struct {
-	ID string `json:"id"`
+// PlaylistsReturnJSON : the user's saved playlists
+type PlaylistsReturnJSON struct {
+	Items []spotify.SimplePlaylist `json:"items"`
+	Total int                      `json:"total"`
 }
 
-// PlaylistTracksBody : post tracks to playlist
-type PlaylistTracksBody struct {
-	URIS []string `json:"uris"`
+// PlaylistPatchBody : insert uris (appending without a position), or move
+// rangeLength tracks from rangeStart to before insertBefore
+type PlaylistPatchBody struct {
+	URIS         []string `json:"uris"`
+	Position     *int     `json:"position"`
+	RangeStart   *int     `json:"rangeStart"`
+	InsertBefore *int     `json:"insertBefore"`
+	RangeLength  int      `json:"rangeLength"`
 }
 
-// PlaylistReturnJSON : return data for frontend
-type PlaylistReturnJSON struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+// PlaylistUpdateJSON : result of changing an existing playlist's tracks
+type PlaylistUpdateJSON struct {
+	ID            string   `json:"id"`
+	SnapshotID    string   `json:"snapshotID,omitempty"`
+	TracksAdded   int      `json:"tracksAdded"`
+	TracksRemoved int      `json:"tracksRemoved"`
+	TracksFailed  int      `json:"tracksFailed"`
+	FailedURIs    []string `json:"failedURIs,omitempty"`
+}
+
+// SearchReturnJSON : search pages per spotify type, matching genres, and
+// every result normalized in one list
+type SearchReturnJSON struct {
+	spotify.SearchResult
+	Genres  []string     `json:"genres,omitempty"`
+	Results []SearchItem `json:"results"`
+}
+
+// SearchItem : search result normalized across types
+type SearchItem struct {
+	ID         string `json:"id"`
+	URI        string `json:"uri,omitempty"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Artist     string `json:"artist,omitempty"`
+	ImageURL   string `json:"imageURL,omitempty"`
+	Popularity int    `json:"popularity,omitempty"`
+}
+
+// RecReturnJSON : recommendations, with audio features when requested. Order
+// is the ordering applied, empty when the tracks are in Spotify's order.
+type RecReturnJSON struct {
+	Seeds  []spotify.RecommendationSeed `json:"seeds"`
+	Tracks []RecTrack                   `json:"tracks"`
+	Order  string                       `json:"order,omitempty"`
+}
+
+// RecTrack : recommended track with its audio features and distance from the
+// requested targets (0 is a perfect match)
+type RecTrack struct {
+	spotify.Track
+	AudioFeatures *spotify.AudioFeatures `json:"audio_features,omitempty"`
+	Distance      *float64               `json:"distance,omitempty"`
 }
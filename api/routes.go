@@ -1,22 +1,27 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"micahco/sapi/spotify"
 )
 
 // LoginHandler : /auth/login
 type LoginHandler struct {
-	clientID        string
-	redirectURI     string
-	scope           []string
-	authStateCookie CookieID
+	clientID       string
+	redirectURI    string
+	scope          []string
+	optionalScopes []string
+	pkce           bool
+	sessions       *SessionManager
 }
 
 func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -30,30 +35,81 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func loginGet(w http.ResponseWriter, r *http.Request, h *LoginHandler) {
-	dur := 3600 * time.Second
 	state := GenerateRandomString(16)
-	expiry := time.Now().Add(dur)
-	if err := WriteCookie(w, h.authStateCookie, state, expiry); err != nil {
+	verifier := ""
+	if h.pkce {
+		v, err := spotify.NewCodeVerifier()
+		if err != nil {
+			SendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		verifier = v
+	}
+	session, err := h.sessions.Load(r)
+	if err != nil {
+		session = &Session{State: state, Verifier: verifier}
+		err = h.sessions.Start(w, session)
+	} else {
+		session.State = state
+		session.Verifier = verifier
+		if !session.Authenticated() {
+			session.Expires = time.Now().Add(PendingSessionTTL)
+		}
+		err = h.sessions.Save(session)
+	}
+	if err != nil {
 		SendError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
+
+	// configured scopes, plus those already granted and any optional ones asked for
+	scope := append([]string{}, h.scope...)
+	scope = append(scope, session.Scopes()...)
+	for _, extra := range strings.FieldsFunc(r.URL.Query().Get("scope"), isScopeSeparator) {
+		if !containsString(h.optionalScopes, extra) {
+			SendError(w, http.StatusBadRequest, fmt.Sprintf("Scope %s can't be requested", extra))
+			return
+		}
+		scope = append(scope, extra)
+	}
+	scope = uniqueStrings(scope)
+
 	api := "https://accounts.spotify.com/authorize/"
 	authURL := fmt.Sprintf(
 		"%s?client_id=%s&response_type=%s&redirect_uri=%s&scope=%s&state=%s",
-		api, h.clientID, "code", url.PathEscape(h.redirectURI), strings.Join(h.scope[:], "%20"), state,
+		api, h.clientID, "code", url.PathEscape(h.redirectURI), url.QueryEscape(strings.Join(scope, " ")), state,
 	)
+	if h.pkce {
+		authURL += fmt.Sprintf("&code_challenge_method=S256&code_challenge=%s", spotify.CodeChallenge(verifier))
+	}
 	http.Redirect(w, r, authURL, 302)
 }
 
+// intParam : integer query parameter within [min, max], def when absent
+func intParam(r *http.Request, name string, def int, min int, max int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", name, min, max)
+	}
+	return n, nil
+}
+
+func isScopeSeparator(r rune) bool {
+	return r == ' ' || r == ','
+}
+
 // CallbackHandler : /auth/callback
 type CallbackHandler struct {
-	authStateCookie    CookieID
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
-	redirectURI        string
-	appURL             string
+	sessions     *SessionManager
+	client       *spotify.Client
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	appURL       string
 }
 
 func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -67,13 +123,13 @@ func (h *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func callbackGet(w http.ResponseWriter, r *http.Request, h *CallbackHandler) {
-	originalState, err := ReadCookie(r, h.authStateCookie)
+	session, err := h.sessions.Load(r)
 	if err != nil {
 		SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	newState := r.URL.Query().Get("state")
-	if newState != originalState {
+	if session.State == "" || newState != session.State {
 		SendError(w, http.StatusUnauthorized, "Auth state compormised")
 		return
 	}
@@ -83,24 +139,40 @@ func callbackGet(w http.ResponseWriter, r *http.Request, h *CallbackHandler) {
 		return
 	}
 	code := r.URL.Query().Get("code")
-	token, err := RequestOAuthToken(r, code, h.redirectURI, h.clientID, h.clientSecret)
+	token, err := h.client.ExchangeCode(r.Context(), code, h.redirectURI, session.Verifier, h.clientID, h.clientSecret)
 	if err != nil {
 		SendError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
-	accessTokenExpiry := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
-	yearExpiry := time.Now().Add(365 * 24 * time.Hour)
-	WriteCookie(w, h.accessTokenCookie, token.AccessToken, accessTokenExpiry)
-	WriteCookie(w, h.refreshTokenCookie, token.RefreshToken, yearExpiry)
-	WriteCookie(w, h.tokenExpiryCookie, accessTokenExpiry.Format(TimeLayout), yearExpiry)
-	ClearCookie(w, h.authStateCookie)
+	me, err := h.client.Me(r.Context(), token.AccessToken)
+	if err != nil {
+		SendSpotifyError(w, err)
+		return
+	}
+
+	// replace the pre-login session so its id can't be reused
+	if err := h.sessions.End(w, r); err != nil {
+		SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	newSession := &Session{
+		Token:          *token,
+		Expiry:         time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+		UserID:         me.ID,
+		Country:        me.Country,
+		CountryChecked: true,
+	}
+	if err := h.sessions.Start(w, newSession); err != nil {
+		SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	http.Redirect(w, r, h.appURL, 302)
 }
 
 // LogoutHandler : /auth/logout
 type LogoutHandler struct {
-	cookies []CookieID
-	appURL  string
+	sessions *SessionManager
+	appURL   string
 }
 
 func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -114,22 +186,16 @@ func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func logoutGet(w http.ResponseWriter, r *http.Request, h *LogoutHandler) {
-	for i := 0; i < len(h.cookies); i++ {
-		if err := ClearCookie(w, h.cookies[i]); err != nil {
-			SendError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+	if err := h.sessions.End(w, r); err != nil {
+		SendError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 	http.Redirect(w, r, h.appURL, 302)
 }
 
 // AuthHandler : /auth
 type AuthHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions *SessionManager
 }
 
 func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -143,7 +209,7 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func authGet(w http.ResponseWriter, r *http.Request, h *AuthHandler) {
-	_, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+	_, err := h.sessions.AccessToken(r)
 	if err != nil {
 		SendError(w, http.StatusUnauthorized, err.Error())
 		return
@@ -153,11 +219,12 @@ func authGet(w http.ResponseWriter, r *http.Request, h *AuthHandler) {
 
 // SearchHandler : /search
 type SearchHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions   *SessionManager
+	client     *spotify.Client
+	cache      *ResponseCache
+	app        *spotify.AppToken
+	market     string
+	maxResults int
 }
 
 func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -172,37 +239,87 @@ func (h *SearchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func searchGet(w http.ResponseWriter, r *http.Request, h *SearchHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+	var v Validator
+	q := v.Query(r, "q")
+	types, err := parseSearchTypes(r.URL.Query().Get("type"))
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		v.Fail("type", err.Error())
+	}
+	opts := spotify.SearchOptions{Market: v.Market(r, h.sessions, h.market)}
+	opts.Limit = v.Int(r, "limit", 5, 1, 50)
+	opts.Offset = v.Int(r, "offset", 0, 0, MaxSearchResults-1)
+	all := v.Bool(r, "all")
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
 		return
 	}
-	q := r.URL.Query().Get("q")
-	searchType := r.URL.Query().Get("type")
-	limit := 5
-	api := fmt.Sprintf("/search?q=%s&type=%s&limit=%d&market=US", url.PathEscape(q), searchType, limit)
-	res, err := SpotifyGet(r, api, accessToken)
+	accessToken, err := h.sessions.CatalogToken(r, h.app)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendAuthError(w, err)
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
-		return
+	var catalogTypes []string
+	for _, t := range types {
+		if t != "genre" {
+			catalogTypes = append(catalogTypes, t)
+		}
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+
+	var res SearchReturnJSON
+	status := CacheHit
+	if all {
+		// every page up to the configured maximum, bypassing the cache, and
+		// never past the offset Spotify stops at
+		opts.Limit = 50
+		max := h.maxResults
+		if left := MaxSearchResults - opts.Offset; left < max {
+			max = left
+		}
+		for _, t := range catalogTypes {
+			err := searchAll(r.Context(), h.client, accessToken, q, t, opts, max, &res.SearchResult)
+			if err != nil {
+				SendSpotifyError(w, err)
+				return
+			}
+		}
+		status = CacheMiss
+	} else if len(catalogTypes) > 0 {
+		endpoint := spotify.SearchEndpoint(q, catalogTypes, opts)
+		if status, err = h.cache.Get(r.Context(), accessToken, "search", endpoint, &res.SearchResult); err != nil {
+			SendSpotifyError(w, err)
+			return
+		}
+	}
+
+	// genres aren't a spotify search type, match them against the seed genres
+	if containsString(types, "genre") {
+		var seeds spotify.GenreSeeds
+		genreStatus, err := h.cache.Get(r.Context(), accessToken, "genres", spotify.GenreSeedsEndpoint, &seeds)
+		if err != nil {
+			SendSpotifyError(w, err)
+			return
+		}
+		if genreStatus == CacheMiss {
+			status = CacheMiss
+		}
+		if all {
+			res.Genres = matchGenres(seeds.Genres, q, 0, h.maxResults)
+		} else {
+			res.Genres = matchGenres(seeds.Genres, q, opts.Offset, opts.Limit)
+		}
+	}
+
+	res.Results = SearchItems(types, &res.SearchResult, res.Genres)
+	w.Header().Set("X-Cache", status)
+	SendJSON(w, http.StatusOK, res)
 }
 
 // ArtistHandler : /artist
 type ArtistHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions *SessionManager
+	client   *spotify.Client
+	cache    *ResponseCache
+	app      *spotify.AppToken
 }
 
 func (h *ArtistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -217,35 +334,33 @@ func (h *ArtistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func artistGet(w http.ResponseWriter, r *http.Request, h *ArtistHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
-	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+	var v Validator
+	id := v.ID(r, "id")
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
 		return
 	}
-	id := r.URL.Query().Get("id")
-	endpoint := fmt.Sprintf("/artists/%s", id)
-	res, err := SpotifyGet(r, endpoint, accessToken)
+	accessToken, err := h.sessions.CatalogToken(r, h.app)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendAuthError(w, err)
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	var artist spotify.Artist
+	status, err := h.cache.Get(r.Context(), accessToken, "artist", spotify.ArtistEndpoint(id), &artist)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	w.Header().Set("X-Cache", status)
+	SendJSON(w, http.StatusOK, artist)
 }
 
 // TrackHandler : /track
 type TrackHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions *SessionManager
+	client   *spotify.Client
+	cache    *ResponseCache
+	app      *spotify.AppToken
 }
 
 func (h *TrackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -260,35 +375,35 @@ func (h *TrackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func trackGet(w http.ResponseWriter, r *http.Request, h *TrackHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
-	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+	var v Validator
+	id := v.ID(r, "id")
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
 		return
 	}
-	id := r.URL.Query().Get("id")
-	endpoint := fmt.Sprintf("/tracks/%s", id)
-	res, err := SpotifyGet(r, endpoint, accessToken)
+	accessToken, err := h.sessions.CatalogToken(r, h.app)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendAuthError(w, err)
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	var track spotify.Track
+	status, err := h.cache.Get(r.Context(), accessToken, "track", spotify.TrackEndpoint(id), &track)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	w.Header().Set("X-Cache", status)
+	SendJSON(w, http.StatusOK, track)
 }
 
 // RecHandler : /rec
 type RecHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions    *SessionManager
+	client      *spotify.Client
+	recommender Recommender
+	app         *spotify.AppToken
+	market      string
+	limit       int
 }
 
 func (h *RecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -303,34 +418,79 @@ func (h *RecHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func recGet(w http.ResponseWriter, r *http.Request, h *RecHandler) {
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+	var v Validator
+	market := v.Market(r, h.sessions, h.market)
+	req := ParseRecommendationRequest(r, &v, h.limit)
+	withFeatures := v.Bool(r, "features")
+	order := v.Order(r, "order")
+	filter := ParseRecFilter(r, &v, req)
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
+		return
+	}
+	req.Market = market
+	limit := req.Limit
+	req.Limit = filter.OversampledLimit(limit)
+	accessToken, err := h.sessions.CatalogToken(r, h.app)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendAuthError(w, err)
 		return
 	}
-	url := fmt.Sprintf("/recommendations?market=US&limit=30&%s", r.URL.RawQuery)
-	res, err := SpotifyGet(r, url, accessToken)
+	rec, err := h.recommender.Recommend(r.Context(), accessToken, req)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
-	body, err := ioutil.ReadAll(res.Body)
+	excluded, err := filter.Excluded(r.Context(), h.client, accessToken)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(body)
+	rec.Tracks = filter.Apply(rec.Tracks, excluded, limit)
+	res := RecReturnJSON{Seeds: rec.Seeds, Tracks: make([]RecTrack, len(rec.Tracks))}
+	for i, t := range rec.Tracks {
+		res.Tracks[i].Track = t
+	}
+	if withFeatures || order != "" {
+		features, err := h.client.GetAudioFeatures(r.Context(), accessToken, trackIDs(rec.Tracks))
+		if err != nil && !unavailable(err) {
+			SendSpotifyError(w, err)
+			return
+		}
+		// without audio features the tracks keep their order and carry no
+		// features or distance
+		if features == nil {
+			SendJSON(w, http.StatusOK, res)
+			return
+		}
+		if order != "" {
+			trackFeatures := make([]*spotify.AudioFeatures, len(res.Tracks))
+			for i, t := range res.Tracks {
+				trackFeatures[i] = features[t.ID]
+			}
+			if res.Tracks, err = sequenceTracks(order, res.Tracks, trackFeatures); err != nil {
+				SendError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			res.Order = order
+		}
+		if withFeatures {
+			for i := range res.Tracks {
+				t := &res.Tracks[i]
+				t.AudioFeatures = features[t.ID]
+				if d, ok := TargetDistance(&t.Track, t.AudioFeatures, req.Tunables); ok {
+					t.Distance = &d
+				}
+			}
+		}
+	}
+	SendJSON(w, http.StatusOK, res)
 }
 
 // PlaylistHandler : /playlist
 type PlaylistHandler struct {
-	accessTokenCookie  CookieID
-	refreshTokenCookie CookieID
-	tokenExpiryCookie  CookieID
-	clientID           string
-	clientSecret       string
+	sessions *SessionManager
+	client   *spotify.Client
 }
 
 func (h *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -338,6 +498,15 @@ func (h *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		fmt.Println("POST /playlist")
 		playlistPost(w, r, h)
+	case "PUT":
+		fmt.Println("PUT /playlist")
+		playlistPut(w, r, h)
+	case "PATCH":
+		fmt.Println("PATCH /playlist")
+		playlistPatch(w, r, h)
+	case "DELETE":
+		fmt.Println("DELETE /playlist")
+		playlistDelete(w, r, h)
 	default:
 		SendBadRequest(w, r.Method)
 	}
@@ -345,57 +514,327 @@ func (h *PlaylistHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func playlistPost(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) {
-	// get user access token
-	accessToken, err := LoadAccessToken(w, r, h.accessTokenCookie, h.refreshTokenCookie, h.tokenExpiryCookie, h.clientID, h.clientSecret)
+	// get user session
+	session, err := h.sessions.Authorized(r)
 	if err != nil {
-		SendError(w, http.StatusUnauthorized, err.Error())
+		SendAuthError(w, err)
 		return
 	}
+	accessToken := session.Token.AccessToken
 
-	// get user id
-	meRes, err := SpotifyGet(r, "/me", accessToken)
+	// read tracks and settings from body
+	var body PlaylistTracksBody
+	if !decodeTracksBody(w, r, &body) {
+		return
+	}
+	// an empty playlist is exactly what rollback is there to prevent
+	if len(body.URIS) == 0 {
+		SendError(w, http.StatusBadRequest, "No track uris to add")
+		return
+	}
+	details, err := playlistDetails(body)
 	if err != nil {
 		SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	var me User
-	json.NewDecoder(meRes.Body).Decode(&me)
+	if body.Order != "" && !containsString(OrderModes, body.Order) {
+		SendError(w, http.StatusBadRequest, fmt.Sprintf("Order must be one of %s", strings.Join(OrderModes, ", ")))
+		return
+	}
+	if !RequireScope(w, session, modifyScope(*details.Public)) {
+		return
+	}
+
+	// sequence the tracks before anything is created
+	if body.Order != "" {
+		uris, err := sequenceURIs(r.Context(), h.client, accessToken, body.Order, body.URIS)
+		switch {
+		case err == nil:
+			body.URIS = uris
+		case unavailable(err):
+			// without audio features keep the given order, and say so in the response
+			body.Order = ""
+		default:
+			SendSpotifyError(w, err)
+			return
+		}
+	}
 
 	// create user playlist
-	userPlaylistEndpoint := fmt.Sprintf("/users/%s/playlists", me.ID)
-	var pb PlaylistBody
-	t := time.Now()
-	pb.Name = t.Format("2006-01-02 15:04:05")
-	playlistReqBody := new(bytes.Buffer)
-	json.NewEncoder(playlistReqBody).Encode(pb)
-	playlistReq, err := SpotifyPost(r, userPlaylistEndpoint, playlistReqBody, accessToken)
+	playlist, err := h.client.CreatePlaylist(r.Context(), accessToken, session.UserID, details)
 	if err != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
 
-	// add tracks from body to playlist (pt = playlist tracks)
-	var playlistResponse PlaylistResponse
-	json.NewDecoder(playlistReq.Body).Decode(&playlistResponse)
-	ptEndpoint := fmt.Sprintf("/users/%s/playlists/%s/tracks", me.ID, playlistResponse.ID)
-	_, postErr := SpotifyPost(r, ptEndpoint, r.Body, accessToken)
-	if postErr != nil {
-		SendError(w, http.StatusBadRequest, err.Error())
+	// add tracks from body to playlist, deleting the playlist again if none could be added
+	added := AddTracksInBatches(r.Context(), h.client, accessToken, playlist.ID, 0, body.URIS)
+	if added.Succeeded == 0 && added.Err != nil {
+		if err := RollbackPlaylist(h.client, accessToken, playlist.ID); err != nil {
+			fmt.Printf("rollback of playlist %s failed: %v\n", playlist.ID, err)
+		}
+		SendSpotifyError(w, added.Err)
 		return
 	}
 
 	// create return object
 	p := PlaylistReturnJSON{
-		ID:       playlistResponse.ID,
-		Username: me.ID,
+		ID:            playlist.ID,
+		Username:      session.UserID,
+		Name:          details.Name,
+		Description:   details.Description,
+		Public:        *details.Public,
+		Collaborative: details.Collaborative,
+		TracksAdded:   added.Succeeded,
+		TracksFailed:  len(added.FailedURIs),
+		FailedURIs:    added.FailedURIs,
+		Order:         body.Order,
+	}
+	SendJSON(w, http.StatusOK, p)
+}
+
+// playlistPut : replace the tracks of playlist ?id= with the body's uris
+func playlistPut(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) {
+	session, id, ok := loadPlaylistRequest(w, r, h)
+	if !ok {
+		return
 	}
-	playlistJSON, err := json.Marshal(p)
+	var body PlaylistTracksBody
+	if !decodeTracksBody(w, r, &body) {
+		return
+	}
+	// a body without uris mustn't clear the playlist by accident
+	if body.URIS == nil {
+		SendError(w, http.StatusBadRequest, "Body needs uris, an empty list clears the playlist")
+		return
+	}
+	accessToken := session.Token.AccessToken
+
+	// replace with the first batch, then append the rest
+	first := body.URIS
+	if len(first) > spotify.MaxTracksPerRequest {
+		first = first[:spotify.MaxTracksPerRequest]
+	}
+	snapshotID, err := h.client.ReplaceTracks(r.Context(), accessToken, id, first)
 	if err != nil {
-		SendError(w, http.StatusInternalServerError, err.Error())
+		SendSpotifyError(w, err)
 		return
 	}
+	rest := AddTracksInBatches(r.Context(), h.client, accessToken, id, -1, body.URIS[len(first):])
+	SendJSON(w, http.StatusOK, PlaylistUpdateJSON{
+		ID:           id,
+		SnapshotID:   snapshotID,
+		TracksAdded:  len(first) + rest.Succeeded,
+		TracksFailed: len(rest.FailedURIs),
+		FailedURIs:   rest.FailedURIs,
+	})
+}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(playlistJSON)
+// playlistPatch : insert the body's uris into playlist ?id=, or reorder its tracks
+func playlistPatch(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) {
+	session, id, ok := loadPlaylistRequest(w, r, h)
+	if !ok {
+		return
+	}
+	var body PlaylistPatchBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	accessToken := session.Token.AccessToken
+
+	switch {
+	case len(body.URIS) > 0:
+		if invalid := InvalidTrackURIs(body.URIS); len(invalid) > 0 {
+			SendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid track uris: %s", strings.Join(invalid, ", ")))
+			return
+		}
+		start := -1
+		if body.Position != nil {
+			if *body.Position < 0 {
+				SendError(w, http.StatusBadRequest, "Position can't be negative")
+				return
+			}
+			start = *body.Position
+		}
+		added := AddTracksInBatches(r.Context(), h.client, accessToken, id, start, body.URIS)
+		if added.Succeeded == 0 && added.Err != nil {
+			SendSpotifyError(w, added.Err)
+			return
+		}
+		SendJSON(w, http.StatusOK, PlaylistUpdateJSON{
+			ID:           id,
+			TracksAdded:  added.Succeeded,
+			TracksFailed: len(added.FailedURIs),
+			FailedURIs:   added.FailedURIs,
+		})
+	case body.RangeStart != nil && body.InsertBefore != nil:
+		if *body.RangeStart < 0 || *body.InsertBefore < 0 || body.RangeLength < 0 {
+			SendError(w, http.StatusBadRequest, "Range positions can't be negative")
+			return
+		}
+		reorder := spotify.Reorder{
+			RangeStart:   *body.RangeStart,
+			InsertBefore: *body.InsertBefore,
+			RangeLength:  body.RangeLength,
+		}
+		snapshotID, err := h.client.ReorderTracks(r.Context(), accessToken, id, reorder)
+		if err != nil {
+			SendSpotifyError(w, err)
+			return
+		}
+		SendJSON(w, http.StatusOK, PlaylistUpdateJSON{ID: id, SnapshotID: snapshotID})
+	default:
+		SendError(w, http.StatusBadRequest, "Body needs uris to insert or rangeStart and insertBefore to reorder")
+	}
+}
+
+// playlistDelete : remove the body's uris from playlist ?id=
+func playlistDelete(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) {
+	session, id, ok := loadPlaylistRequest(w, r, h)
+	if !ok {
+		return
+	}
+	var body PlaylistTracksBody
+	if !decodeTracksBody(w, r, &body) {
+		return
+	}
+	if len(body.URIS) == 0 {
+		SendError(w, http.StatusBadRequest, "No track uris to remove")
+		return
+	}
+	removed := RemoveTracksInBatches(r.Context(), h.client, session.Token.AccessToken, id, body.URIS)
+	if removed.Succeeded == 0 && removed.Err != nil {
+		SendSpotifyError(w, removed.Err)
+		return
+	}
+	SendJSON(w, http.StatusOK, PlaylistUpdateJSON{
+		ID:            id,
+		TracksRemoved: removed.Succeeded,
+		TracksFailed:  len(removed.FailedURIs),
+		FailedURIs:    removed.FailedURIs,
+	})
+}
+
+// loadPlaylistRequest : logged-in session and ?id= for changing an existing playlist
+func loadPlaylistRequest(w http.ResponseWriter, r *http.Request, h *PlaylistHandler) (*Session, string, bool) {
+	session, err := h.sessions.Authorized(r)
+	if err != nil {
+		SendAuthError(w, err)
+		return nil, "", false
+	}
+	var v Validator
+	id := v.ID(r, "id")
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
+		return nil, "", false
+	}
+	// report a missing scope ourselves rather than as Spotify's bare 403
+	playlist, err := h.client.GetPlaylist(r.Context(), session.Token.AccessToken, id)
+	if err != nil {
+		SendSpotifyError(w, err)
+		return nil, "", false
+	}
+	public := playlist.Public != nil && *playlist.Public
+	if !RequireScope(w, session, modifyScope(public)) {
+		return nil, "", false
+	}
+	return session, id, true
+}
+
+// modifyScope : scope needed to change a public or private playlist
+func modifyScope(public bool) string {
+	if public {
+		return "playlist-modify-public"
+	}
+	return "playlist-modify-private"
+}
+
+// decodeTracksBody : read a PlaylistTracksBody and validate its uris
+func decodeTracksBody(w http.ResponseWriter, r *http.Request, body *PlaylistTracksBody) bool {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		SendError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if invalid := InvalidTrackURIs(body.URIS); len(invalid) > 0 {
+		SendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid track uris: %s", strings.Join(invalid, ", ")))
+		return false
+	}
+	return true
+}
+
+// PlaylistsHandler : /playlists
+type PlaylistsHandler struct {
+	sessions *SessionManager
+	client   *spotify.Client
+}
+
+func (h *PlaylistsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		fmt.Println("GET /playlists")
+		playlistsGet(w, r, h)
+	default:
+		SendBadRequest(w, r.Method)
+	}
+}
+
+func playlistsGet(w http.ResponseWriter, r *http.Request, h *PlaylistsHandler) {
+	session, err := h.sessions.Authorized(r)
+	if err != nil {
+		SendAuthError(w, err)
+		return
+	}
+	var v Validator
+	owned := v.Bool(r, "owned")
+	if !v.Valid() {
+		SendValidationError(w, v.Errors)
+		return
+	}
+	pager := h.client.MyPlaylists(session.Token.AccessToken)
+	items, err := pager.All(r.Context(), MaxListItems)
+	if err != nil {
+		SendSpotifyError(w, err)
+		return
+	}
+	playlists := PlaylistsReturnJSON{Items: []spotify.SimplePlaylist{}}
+	for _, p := range items {
+		if owned && p.Owner.ID != session.UserID {
+			continue
+		}
+		playlists.Items = append(playlists.Items, p)
+	}
+	playlists.Total = len(playlists.Items)
+	SendJSON(w, http.StatusOK, playlists)
+}
+
+// playlistDetails : validate the settings in body, defaulting to a public
+// playlist named after the current time
+func playlistDetails(body PlaylistTracksBody) (spotify.PlaylistDetails, error) {
+	d := spotify.PlaylistDetails{
+		Name:          strings.TrimSpace(body.Name),
+		Description:   strings.TrimSpace(body.Description),
+		Public:        body.Public,
+		Collaborative: body.Collaborative,
+	}
+	if d.Name == "" {
+		d.Name = time.Now().Format("2006-01-02 15:04:05")
+	}
+	if utf8.RuneCountInString(d.Name) > 100 {
+		return d, errors.New("Playlist name must be at most 100 characters")
+	}
+	if utf8.RuneCountInString(d.Description) > 300 {
+		return d, errors.New("Playlist description must be at most 300 characters")
+	}
+	if strings.ContainsAny(d.Description, "\r\n") {
+		return d, errors.New("Playlist description can't contain line breaks")
+	}
+	if d.Public == nil {
+		public := !d.Collaborative
+		d.Public = &public
+	}
+	if d.Collaborative && *d.Public {
+		return d, errors.New("Collaborative playlists can't be public")
+	}
+	return d, nil
 }
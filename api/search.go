@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"micahco/sapi/spotify"
+)
+
+// MaxSearchResults : Spotify refuses search offsets past 1000, so no search
+// can page further than this
+const MaxSearchResults = 1000
+
+// SearchTypes : types /search accepts, in the order results are listed
+var SearchTypes = []string{"artist", "track", "album", "playlist", "genre"}
+
+// parseSearchTypes : comma-separated types, deduplicated and in SearchTypes order
+func parseSearchTypes(param string) ([]string, error) {
+	requested := make(map[string]bool)
+	for _, t := range strings.Split(param, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		if !containsString(SearchTypes, t) {
+			return nil, fmt.Errorf("Unknown search type %q, type must be one or more of %s", t, strings.Join(SearchTypes, ","))
+		}
+		requested[t] = true
+	}
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("type is required, one or more of %s", strings.Join(SearchTypes, ","))
+	}
+	var types []string
+	for _, t := range SearchTypes {
+		if requested[t] {
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
+
+// searchAll : follow search pages for searchType into result until max results are collected
+func searchAll(ctx context.Context, client *spotify.Client, token string, q string, searchType string, opts spotify.SearchOptions, max int, result *spotify.SearchResult) error {
+	var err error
+	switch searchType {
+	case "artist":
+		result.Artists, err = collectPage(ctx, spotify.NewSearchPager[spotify.Artist](client, token, q, searchType, opts), max)
+	case "track":
+		result.Tracks, err = collectPage(ctx, spotify.NewSearchPager[spotify.Track](client, token, q, searchType, opts), max)
+	case "album":
+		result.Albums, err = collectPage(ctx, spotify.NewSearchPager[spotify.SimpleAlbum](client, token, q, searchType, opts), max)
+	case "playlist":
+		result.Playlists, err = collectPage(ctx, spotify.NewSearchPager[spotify.SimplePlaylist](client, token, q, searchType, opts), max)
+	default:
+		err = fmt.Errorf("Can't page search type %s", searchType)
+	}
+	return err
+}
+
+// collectPage : one page holding the items of every page pager visits, up to max
+func collectPage[T any](ctx context.Context, pager *spotify.Pager[T], max int) (*spotify.Page[T], error) {
+	items, err := pager.All(ctx, max)
+	if err != nil {
+		return nil, err
+	}
+	page := &spotify.Page[T]{Items: items, Limit: len(items)}
+	// Page is the last page fetched, every page reports the same total
+	if last := pager.Page(); last != nil {
+		page.Total = last.Total
+	}
+	if items == nil {
+		page.Items = []T{}
+	}
+	return page, nil
+}
+
+// matchGenres : genres containing q, ignoring case, from offset up to limit
+func matchGenres(genres []string, q string, offset int, limit int) []string {
+	q = strings.ToLower(strings.TrimSpace(q))
+	matched := []string{}
+	for _, g := range genres {
+		if strings.Contains(strings.ToLower(g), q) {
+			matched = append(matched, g)
+		}
+	}
+	if offset >= len(matched) {
+		return []string{}
+	}
+	matched = matched[offset:]
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched
+}
+
+// SearchItems : every result in types order, normalized to one shape
+func SearchItems(types []string, result *spotify.SearchResult, genres []string) []SearchItem {
+	items := []SearchItem{}
+	for _, t := range types {
+		switch {
+		case t == "artist" && result.Artists != nil:
+			for _, a := range result.Artists.Items {
+				items = append(items, SearchItem{
+					ID:         a.ID,
+					URI:        a.URI,
+					Type:       "artist",
+					Name:       a.Name,
+					ImageURL:   firstImage(a.Images),
+					Popularity: a.Popularity,
+				})
+			}
+		case t == "track" && result.Tracks != nil:
+			for _, tr := range result.Tracks.Items {
+				items = append(items, SearchItem{
+					ID:         tr.ID,
+					URI:        tr.URI,
+					Type:       "track",
+					Name:       tr.Name,
+					Artist:     primaryArtist(tr.Artists),
+					ImageURL:   firstImage(tr.Album.Images),
+					Popularity: tr.Popularity,
+				})
+			}
+		case t == "album" && result.Albums != nil:
+			for _, al := range result.Albums.Items {
+				items = append(items, SearchItem{
+					ID:       al.ID,
+					URI:      al.URI,
+					Type:     "album",
+					Name:     al.Name,
+					Artist:   primaryArtist(al.Artists),
+					ImageURL: firstImage(al.Images),
+				})
+			}
+		case t == "playlist" && result.Playlists != nil:
+			for _, p := range result.Playlists.Items {
+				items = append(items, SearchItem{
+					ID:       p.ID,
+					URI:      p.URI,
+					Type:     "playlist",
+					Name:     p.Name,
+					Artist:   p.Owner.DisplayName,
+					ImageURL: firstImage(p.Images),
+				})
+			}
+		case t == "genre":
+			for _, g := range genres {
+				items = append(items, SearchItem{ID: g, Type: "genre", Name: g})
+			}
+		}
+	}
+	return items
+}
+
+func primaryArtist(artists []spotify.SimpleArtist) string {
+	if len(artists) == 0 {
+		return ""
+	}
+	return artists[0].Name
+}
+
+// firstImage : url of the first (largest) image
+func firstImage(images []spotify.Image) string {
+	if len(images) == 0 {
+		return ""
+	}
+	return images[0].URL
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"micahco/sapi/spotify"
+)
+
+const (
+	// OrderHarmonic : each track followed by the closest in Camelot key, tempo and energy
+	OrderHarmonic = "harmonic"
+	// OrderEnergyArc : energy builds up to a peak about two thirds in, then cools down
+	OrderEnergyArc = "energy_arc"
+)
+
+// OrderModes : ordering modes for /rec and /playlist
+var OrderModes = []string{OrderHarmonic, OrderEnergyArc}
+
+// Order : ordering mode parameter, empty when absent
+func (v *Validator) Order(r *http.Request, name string) string {
+	mode := r.URL.Query().Get(name)
+	if mode != "" && !containsString(OrderModes, mode) {
+		v.Fail(name, "%s must be one of %s", name, strings.Join(OrderModes, ", "))
+	}
+	return mode
+}
+
+// Sequence : order for items with the given audio features, as a permutation
+// of their indexes. Items without features keep their relative order at the end.
+func Sequence(mode string, features []*spotify.AudioFeatures) ([]int, error) {
+	var known, unknown []int
+	for i, f := range features {
+		if f == nil || f.Key < 0 {
+			unknown = append(unknown, i)
+		} else {
+			known = append(known, i)
+		}
+	}
+	switch mode {
+	case OrderHarmonic:
+		known = harmonicOrder(known, features)
+	case OrderEnergyArc:
+		known = energyArc(known, features)
+	default:
+		return nil, fmt.Errorf("Unknown order %q", mode)
+	}
+	return append(known, unknown...), nil
+}
+
+// camelot : position on the Camelot wheel, number 1-12 and minor for the A ring
+type camelot struct {
+	number int
+	minor  bool
+}
+
+// camelotKey : wheel position of a pitch class (0 = C) and mode (1 = major)
+func camelotKey(key int, mode int) camelot {
+	if mode == 1 {
+		return camelot{number: (7*key+7)%12 + 1}
+	}
+	return camelot{number: (7*key+4)%12 + 1, minor: true}
+}
+
+// camelotDistance : steps around the wheel plus one for switching rings.
+// 0 is the same key and 1 a compatible mix (adjacent number or relative key).
+func camelotDistance(a camelot, b camelot) int {
+	d := a.number - b.number
+	if d < 0 {
+		d = -d
+	}
+	if d > 6 {
+		d = 12 - d
+	}
+	if a.minor != b.minor {
+		d++
+	}
+	return d
+}
+
+// transitionCost : how rough going from a to b sounds, key clashes weigh
+// most, then energy jumps, then tempo changes
+func transitionCost(a *spotify.AudioFeatures, b *spotify.AudioFeatures) float64 {
+	key := float64(camelotDistance(camelotKey(a.Key, a.Mode), camelotKey(b.Key, b.Mode)))
+	return key + 2*math.Abs(a.Energy-b.Energy) + math.Abs(a.Tempo-b.Tempo)/20
+}
+
+// harmonicOrder : greedy walk from the lowest energy track, always moving to
+// the cheapest transition left
+func harmonicOrder(items []int, features []*spotify.AudioFeatures) []int {
+	if len(items) == 0 {
+		return items
+	}
+	left := append([]int{}, items...)
+	start := 0
+	for i, item := range left {
+		if features[item].Energy < features[left[start]].Energy {
+			start = i
+		}
+	}
+	order := []int{left[start]}
+	left = append(left[:start], left[start+1:]...)
+	for len(left) > 0 {
+		current := features[order[len(order)-1]]
+		next := 0
+		for i, item := range left {
+			if transitionCost(current, features[item]) < transitionCost(current, features[left[next]]) {
+				next = i
+			}
+		}
+		order = append(order, left[next])
+		left = append(left[:next], left[next+1:]...)
+	}
+	return order
+}
+
+// energyArc : two of every three tracks by rising energy build up to the
+// peak, the rest follow it falling
+func energyArc(items []int, features []*spotify.AudioFeatures) []int {
+	sorted := append([]int{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return features[sorted[i]].Energy < features[sorted[j]].Energy
+	})
+	var rising, falling []int
+	for i, item := range sorted {
+		if i%3 == 1 {
+			falling = append(falling, item)
+		} else {
+			rising = append(rising, item)
+		}
+	}
+	order := rising
+	for i := len(falling) - 1; i >= 0; i-- {
+		order = append(order, falling[i])
+	}
+	return order
+}
+
+// trackIDFromURI : id of a spotify:track: uri, false for other uris
+func trackIDFromURI(uri string) (string, bool) {
+	const prefix = "spotify:track:"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(uri, prefix), true
+}
+
+// sequenceTracks : tracks reordered by mode, features[i] belonging to tracks[i]
+func sequenceTracks(mode string, tracks []RecTrack, features []*spotify.AudioFeatures) ([]RecTrack, error) {
+	order, err := Sequence(mode, features)
+	if err != nil {
+		return nil, err
+	}
+	sequenced := make([]RecTrack, len(order))
+	for i, j := range order {
+		sequenced[i] = tracks[j]
+	}
+	return sequenced, nil
+}
+
+// sequenceURIs : track uris reordered by mode, with their audio features
+// fetched from Spotify. Episodes have no features and go last.
+func sequenceURIs(ctx context.Context, client *spotify.Client, token string, mode string, uris []string) ([]string, error) {
+	var ids []string
+	for _, uri := range uris {
+		if id, ok := trackIDFromURI(uri); ok {
+			ids = append(ids, id)
+		}
+	}
+	features, err := client.GetAudioFeatures(ctx, token, uniqueStrings(ids))
+	if err != nil {
+		return nil, err
+	}
+	uriFeatures := make([]*spotify.AudioFeatures, len(uris))
+	for i, uri := range uris {
+		if id, ok := trackIDFromURI(uri); ok {
+			uriFeatures[i] = features[id]
+		}
+	}
+	order, err := Sequence(mode, uriFeatures)
+	if err != nil {
+		return nil, err
+	}
+	sequenced := make([]string, len(order))
+	for i, j := range order {
+		sequenced[i] = uris[j]
+	}
+	return sequenced, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"micahco/sapi/spotify"
+)
+
+var (
+	// ErrSessionNotFound : no session is stored under the requested id
+	ErrSessionNotFound = errors.New("Session not found")
+	// ErrNotLoggedIn : the session has no spotify token
+	ErrNotLoggedIn = errors.New("Not logged in")
+)
+
+const (
+	// PendingSessionTTL : lifetime of a session that hasn't finished logging in
+	PendingSessionTTL = 10 * time.Minute
+	// SessionTTL : lifetime of a logged-in session and its cookie
+	SessionTTL = 365 * 24 * time.Hour
+	// CountryRetryInterval : wait before asking /me for the country again after it failed
+	CountryRetryInterval = 10 * time.Minute
+	// SessionSweepInterval : how often expired sessions are deleted from the store
+	SessionSweepInterval = time.Hour
+)
+
+// Session : server-side state referenced by the session cookie
+type Session struct {
+	ID             string        `json:"-"`
+	State          string        `json:"state,omitempty"`
+	Verifier       string        `json:"verifier,omitempty"`
+	Token          spotify.Token `json:"token"`
+	Expiry         time.Time     `json:"expiry"`
+	UserID         string        `json:"userID"`
+	Country        string        `json:"country,omitempty"`
+	CountryChecked bool          `json:"countryChecked,omitempty"`
+	CountryRetry   time.Time     `json:"countryRetry,omitempty"`
+	Expires        time.Time     `json:"expires"`
+}
+
+// Authenticated : session holds a spotify token
+func (s *Session) Authenticated() bool {
+	return s.Token.RefreshToken != ""
+}
+
+// Expired : the session's lifetime is over at now. Sessions stored before
+// lifetimes were recorded only live on if they're logged in.
+func (s *Session) Expired(now time.Time) bool {
+	if s.Expires.IsZero() {
+		return !s.Authenticated()
+	}
+	return now.After(s.Expires)
+}
+
+// Scopes : scopes granted to the session's token
+func (s *Session) Scopes() []string {
+	return strings.Fields(s.Token.Scope)
+}
+
+// HasScope : session's token was granted scope
+func (s *Session) HasScope(scope string) bool {
+	for _, granted := range s.Scopes() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionStore : persistence for sessions keyed by session id
+type SessionStore interface {
+	Get(id string) (*Session, error)
+	Save(s *Session) error
+	Delete(id string) error
+	// DeleteExpired : remove every session expired at now, returning how many
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// SessionManager : loads and saves the session referenced by the session cookie
+type SessionManager struct {
+	store        SessionStore
+	cookie       CookieID
+	client       *spotify.Client
+	clientID     string
+	clientSecret string
+	refreshes    *Coalescer
+}
+
+// NewSessionManager : create a session manager backed by store
+func NewSessionManager(store SessionStore, cookie CookieID, client *spotify.Client, clientID string, clientSecret string) *SessionManager {
+	return &SessionManager{
+		store:        store,
+		cookie:       cookie,
+		client:       client,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		refreshes:    NewCoalescer(),
+	}
+}
+
+// Load : read the session cookie and fetch its session from the store
+func (m *SessionManager) Load(r *http.Request) (*Session, error) {
+	id, err := ReadCookie(r, m.cookie)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.ID = id
+	now := time.Now()
+	if s.Expired(now) {
+		if err := m.store.Delete(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrSessionNotFound
+	}
+	if s.Expires.IsZero() {
+		s.Expires = now.Add(SessionTTL)
+		if err := m.store.Save(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Start : store s under a new session id and write the session cookie. A
+// session that isn't logged in yet only lives for PendingSessionTTL.
+func (m *SessionManager) Start(w http.ResponseWriter, s *Session) error {
+	s.ID = GenerateRandomString(32)
+	ttl := SessionTTL
+	if !s.Authenticated() {
+		ttl = PendingSessionTTL
+	}
+	s.Expires = time.Now().Add(ttl)
+	if err := m.store.Save(s); err != nil {
+		return err
+	}
+	return WriteCookie(w, m.cookie, s.ID, s.Expires)
+}
+
+// Save : persist changes to an existing session
+func (m *SessionManager) Save(s *Session) error {
+	return m.store.Save(s)
+}
+
+// Sweep : delete expired sessions every interval, for as long as the process runs
+func (m *SessionManager) Sweep(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := m.store.DeleteExpired(time.Now()); err != nil {
+			fmt.Printf("deleting expired sessions failed: %v\n", err)
+		}
+	}
+}
+
+// End : delete the session and clear the session cookie
+func (m *SessionManager) End(w http.ResponseWriter, r *http.Request) error {
+	if id, err := ReadCookie(r, m.cookie); err == nil {
+		if err := m.store.Delete(id); err != nil {
+			return err
+		}
+	}
+	return ClearCookie(w, m.cookie)
+}
+
+// Authorized : load the logged-in session, refreshing its access token if expired
+func (m *SessionManager) Authorized(r *http.Request) (*Session, error) {
+	s, err := m.Load(r)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Authenticated() {
+		return nil, ErrNotLoggedIn
+	}
+	if time.Since(s.Expiry) > 0 {
+		// one refresh per session at a time: with PKCE every refresh rotates the
+		// refresh token, so concurrent refreshes would revoke each other's
+		val, _, err := m.refreshes.Do(r.Context(), s.ID, func() (interface{}, error) {
+			return m.refresh(s.ID)
+		})
+		if err != nil {
+			return nil, err
+		}
+		refreshed := *val.(*Session)
+		s = &refreshed
+	}
+	return s, nil
+}
+
+// refresh : refresh the access token of session id, re-reading the session
+// first so a refresh that already happened isn't repeated with a stale token
+func (m *SessionManager) refresh(id string) (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ClientTimeout)
+	defer cancel()
+	s, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	s.ID = id
+	if time.Since(s.Expiry) <= 0 {
+		return s, nil
+	}
+	token, err := m.client.RefreshToken(ctx, s.Token.RefreshToken, m.clientID, m.clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.Token.RefreshToken
+	}
+	if token.Scope == "" {
+		token.Scope = s.Token.Scope
+	}
+	s.Token = *token
+	s.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	if err := m.store.Save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AccessToken : load the logged-in session's access token
+func (m *SessionManager) AccessToken(r *http.Request) (string, error) {
+	s, err := m.Authorized(r)
+	if err != nil {
+		return "", err
+	}
+	return s.Token.AccessToken, nil
+}
+
+// CatalogToken : access token for catalog reads, the logged-in user's when
+// there is one and the app's otherwise (if app tokens are available)
+func (m *SessionManager) CatalogToken(r *http.Request, app *spotify.AppToken) (string, error) {
+	token, err := m.AccessToken(r)
+	if err == nil || app == nil {
+		return token, err
+	}
+	return app.Token(r.Context())
+}
+
+// Country : the logged-in user's country, fetched from /me once and cached
+// in the session. Empty when not logged in or Spotify doesn't share it (/me
+// leaves country out without the user-read-private scope).
+func (m *SessionManager) Country(r *http.Request) string {
+	s, err := m.Authorized(r)
+	if err != nil {
+		return ""
+	}
+	if !s.CountryChecked && time.Now().After(s.CountryRetry) {
+		me, err := m.client.Me(r.Context(), s.Token.AccessToken)
+		if err != nil {
+			// don't ask /me on every request while it fails
+			s.CountryRetry = time.Now().Add(CountryRetryInterval)
+		} else {
+			s.Country = me.Country
+			s.CountryChecked = true
+		}
+		if err := m.store.Save(s); err != nil {
+			fmt.Printf("saving country for session failed: %v\n", err)
+		}
+	}
+	return s.Country
+}
@@ -0,0 +1,83 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ClientCredentials : request an app-only token with the client credentials grant
+func (c *Client) ClientCredentials(ctx context.Context, clientID string, clientSecret string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	return c.RequestToken(ctx, form, clientID, clientSecret)
+}
+
+// AppToken : caches a client credentials token for catalog reads that don't
+// need a user, refreshing it in the background before it expires
+type AppToken struct {
+	RefreshBefore time.Duration
+
+	client       *Client
+	clientID     string
+	clientSecret string
+
+	mu         sync.Mutex
+	token      string
+	expiry     time.Time
+	refreshing bool
+}
+
+// NewAppToken : create an app token source for clientID
+func NewAppToken(client *Client, clientID string, clientSecret string) *AppToken {
+	return &AppToken{
+		RefreshBefore: 5 * time.Minute,
+		client:        client,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+	}
+}
+
+// Token : current app access token. An expired token is refreshed before
+// returning, one close to expiry is refreshed in the background.
+func (a *AppToken) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.token == "" || !now.Before(a.expiry) {
+		if err := a.refresh(ctx); err != nil {
+			return "", err
+		}
+		return a.token, nil
+	}
+	if !a.refreshing && now.Add(a.RefreshBefore).After(a.expiry) {
+		a.refreshing = true
+		go func() {
+			t, err := a.client.ClientCredentials(context.Background(), a.clientID, a.clientSecret)
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if err == nil {
+				a.set(t)
+			}
+			a.refreshing = false
+		}()
+	}
+	return a.token, nil
+}
+
+// refresh : fetch a new token, a.mu must be held
+func (a *AppToken) refresh(ctx context.Context) error {
+	t, err := a.client.ClientCredentials(ctx, a.clientID, a.clientSecret)
+	if err != nil {
+		return err
+	}
+	a.set(t)
+	return nil
+}
+
+// set : store t, a.mu must be held
+func (a *AppToken) set(t *Token) {
+	a.token = t.AccessToken
+	a.expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+}
@@ -0,0 +1,31 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// ArtistTopTracks : an artist's most popular tracks in market
+func (c *Client) ArtistTopTracks(ctx context.Context, token string, id string, market string) ([]Track, error) {
+	var res struct {
+		Tracks []Track `json:"tracks"`
+	}
+	endpoint := fmt.Sprintf("/artists/%s/top-tracks?market=%s", url.PathEscape(id), url.QueryEscape(market))
+	if err := c.Get(ctx, token, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return res.Tracks, nil
+}
+
+// RelatedArtists : artists similar to an artist
+func (c *Client) RelatedArtists(ctx context.Context, token string, id string) ([]Artist, error) {
+	var res struct {
+		Artists []Artist `json:"artists"`
+	}
+	endpoint := fmt.Sprintf("/artists/%s/related-artists", url.PathEscape(id))
+	if err := c.Get(ctx, token, endpoint, &res); err != nil {
+		return nil, err
+	}
+	return res.Artists, nil
+}
@@ -0,0 +1,87 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SearchOptions : optional /search parameters, zero values are omitted
+type SearchOptions struct {
+	Limit  int
+	Offset int
+	Market string
+}
+
+// Search : search the catalog for query across types (artist, track, album, playlist)
+func (c *Client) Search(ctx context.Context, token string, query string, types []string, opts SearchOptions) (*SearchResult, error) {
+	var res SearchResult
+	if err := c.Get(ctx, token, SearchEndpoint(query, types, opts), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SearchEndpoint : /search path and query for Search
+func SearchEndpoint(query string, types []string, opts SearchOptions) string {
+	v := url.Values{}
+	v.Set("q", query)
+	v.Set("type", strings.Join(types, ","))
+	if opts.Limit > 0 {
+		v.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		v.Set("offset", strconv.Itoa(opts.Offset))
+	}
+	if opts.Market != "" {
+		v.Set("market", opts.Market)
+	}
+	return "/search?" + v.Encode()
+}
+
+// GetArtist : fetch an artist by id
+func (c *Client) GetArtist(ctx context.Context, token string, id string) (*Artist, error) {
+	var a Artist
+	if err := c.Get(ctx, token, ArtistEndpoint(id), &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// ArtistEndpoint : path for GetArtist
+func ArtistEndpoint(id string) string {
+	return fmt.Sprintf("/artists/%s", url.PathEscape(id))
+}
+
+// GetTrack : fetch a track by id
+func (c *Client) GetTrack(ctx context.Context, token string, id string) (*Track, error) {
+	var t Track
+	if err := c.Get(ctx, token, TrackEndpoint(id), &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// TrackEndpoint : path for GetTrack
+func TrackEndpoint(id string) string {
+	return fmt.Sprintf("/tracks/%s", url.PathEscape(id))
+}
+
+// GenreSeedsEndpoint : path for GenreSeeds
+const GenreSeedsEndpoint = "/recommendations/available-genre-seeds"
+
+// GenreSeeds : genres usable as recommendation seeds
+type GenreSeeds struct {
+	Genres []string `json:"genres"`
+}
+
+// GetGenreSeeds : fetch the genres usable as recommendation seeds
+func (c *Client) GetGenreSeeds(ctx context.Context, token string) (*GenreSeeds, error) {
+	var g GenreSeeds
+	if err := c.Get(ctx, token, GenreSeedsEndpoint, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
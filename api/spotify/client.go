@@ -0,0 +1,212 @@
+// Package spotify is a small typed client for the Spotify Web API.
+package spotify
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBaseURL : Spotify Web API root
+	DefaultBaseURL = "https://api.spotify.com/v1"
+	// DefaultAccountsURL : Spotify accounts service root
+	DefaultAccountsURL = "https://accounts.spotify.com"
+	// DefaultTimeout : timeout for the default http.Client
+	DefaultTimeout = time.Second * 10
+)
+
+// Client : Spotify Web API client, safe for concurrent use
+type Client struct {
+	BaseURL     string
+	AccountsURL string
+	HTTPClient  *http.Client
+	Retry       RetryPolicy
+}
+
+// NewClient : create a client sending requests through httpClient, or a
+// client with DefaultTimeout on the shared default transport when nil
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{
+		BaseURL:     DefaultBaseURL,
+		AccountsURL: DefaultAccountsURL,
+		HTTPClient:  httpClient,
+		Retry:       DefaultRetryPolicy,
+	}
+}
+
+// Get : GET endpoint and decode the json response into v
+func (c *Client) Get(ctx context.Context, token string, endpoint string, v interface{}) error {
+	return c.Do(ctx, token, http.MethodGet, endpoint, nil, v)
+}
+
+// Post : POST body as json to endpoint and decode the json response into v
+func (c *Client) Post(ctx context.Context, token string, endpoint string, body interface{}, v interface{}) error {
+	return c.Do(ctx, token, http.MethodPost, endpoint, body, v)
+}
+
+// Put : PUT body as json to endpoint and decode the json response into v
+func (c *Client) Put(ctx context.Context, token string, endpoint string, body interface{}, v interface{}) error {
+	return c.Do(ctx, token, http.MethodPut, endpoint, body, v)
+}
+
+// Delete : DELETE endpoint, sending body as json when non-nil, and decode the json response into v
+func (c *Client) Delete(ctx context.Context, token string, endpoint string, body interface{}, v interface{}) error {
+	return c.Do(ctx, token, http.MethodDelete, endpoint, body, v)
+}
+
+// Do : send an authorized request to endpoint (relative to BaseURL). A non-nil
+// body is encoded as json, a non-nil v receives the decoded json response.
+func (c *Client) Do(ctx context.Context, token string, method string, endpoint string, body interface{}, v interface{}) error {
+	res, err := c.do(ctx, token, method, endpoint, body, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Response : raw body and validator of a GET
+type Response struct {
+	Body        []byte
+	ETag        string
+	NotModified bool
+}
+
+// GetConditional : GET endpoint, revalidating with If-None-Match when etag is
+// set. A 304 is reported as NotModified with an empty body.
+func (c *Client) GetConditional(ctx context.Context, token string, endpoint string, etag string) (*Response, error) {
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	res, err := c.do(ctx, token, http.MethodGet, endpoint, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	r := &Response{ETag: res.Header.Get("ETag")}
+	if res.StatusCode == http.StatusNotModified {
+		r.NotModified = true
+		if r.ETag == "" {
+			r.ETag = etag
+		}
+		return r, nil
+	}
+	if r.Body, err = io.ReadAll(res.Body); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// do : send an authorized request, returning the response when it's a 2xx or 304
+func (c *Client) do(ctx context.Context, token string, method string, endpoint string, body interface{}, header http.Header) (*http.Response, error) {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	res, err := c.send(ctx, method != http.MethodPost, func() (*http.Request, error) {
+		var reqBody io.Reader
+		if b != nil {
+			reqBody = bytes.NewReader(b)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		if b != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		return res, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, newError(res)
+	}
+	return res, nil
+}
+
+// RequestToken : POST form to the accounts token endpoint. Client credentials
+// are sent as basic auth when clientSecret is set, public (PKCE) clients
+// without a secret send only their client_id.
+func (c *Client) RequestToken(ctx context.Context, form url.Values, clientID string, clientSecret string) (*Token, error) {
+	u := c.AccountsURL + "/api/token"
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+	encoded := form.Encode()
+	// authorization codes and rotated refresh tokens only work once, so a
+	// grant that may have been handled is only repeated after a 429
+	idempotent := form.Get("grant_type") == "client_credentials"
+	res, err := c.send(ctx, idempotent, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(encoded))
+		if err != nil {
+			return nil, err
+		}
+		if clientSecret != "" {
+			bearer := fmt.Sprintf("%s:%s", clientID, clientSecret)
+			secret := base64.StdEncoding.EncodeToString([]byte(bearer))
+			req.Header.Set("Authorization", fmt.Sprintf("Basic %s", secret))
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newError(res)
+	}
+	defer res.Body.Close()
+	var t Token
+	if err := json.NewDecoder(res.Body).Decode(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ExchangeCode : exchange an authorization code for a token, sending the
+// PKCE code verifier when one was used to authorize
+func (c *Client) ExchangeCode(ctx context.Context, code string, redirectURI string, verifier string, clientID string, clientSecret string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	if verifier != "" {
+		form.Set("code_verifier", verifier)
+	}
+	return c.RequestToken(ctx, form, clientID, clientSecret)
+}
+
+// RefreshToken : exchange a refresh token for a new access token
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string, clientID string, clientSecret string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return c.RequestToken(ctx, form, clientID, clientSecret)
+}
@@ -0,0 +1,81 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Error : non-2xx response from Spotify
+type Error struct {
+	StatusCode int
+	Message    string
+	Reason     string
+	Endpoint   string
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	s := fmt.Sprintf("%s: %d %s", e.Endpoint, e.StatusCode, msg)
+	if e.err != nil {
+		return fmt.Sprintf("%v: %s", e.err, s)
+	}
+	return s
+}
+
+// Unwrap : ErrRateLimited or ErrUnavailable when retries ran out
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// errorBody : the web api's {"error": {...}} and the accounts service's
+// {"error": "...", "error_description": "..."} shapes
+type errorBody struct {
+	Error            json.RawMessage `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+}
+
+// newError : read res into an Error and close its body
+func newError(res *http.Response) *Error {
+	defer res.Body.Close()
+	e := &Error{StatusCode: res.StatusCode}
+	if res.Request != nil {
+		e.Endpoint = fmt.Sprintf("%s %s", res.Request.Method, res.Request.URL.Path)
+	}
+	if d, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+		e.RetryAfter = d
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	if err != nil {
+		return e
+	}
+	var body errorBody
+	if json.Unmarshal(b, &body) != nil || len(body.Error) == 0 {
+		return e
+	}
+	var api apiError
+	if json.Unmarshal(body.Error, &api) == nil {
+		e.Message = api.Message
+		e.Reason = api.Reason
+		return e
+	}
+	var code string
+	if json.Unmarshal(body.Error, &code) == nil {
+		e.Reason = code
+		e.Message = body.ErrorDescription
+	}
+	return e
+}
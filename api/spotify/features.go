@@ -0,0 +1,87 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// MaxAudioFeaturesIDs : most track ids one audio features request accepts
+const MaxAudioFeaturesIDs = 100
+
+// AudioFeatures : audio analysis summary of a track
+type AudioFeatures struct {
+	ID               string  `json:"id"`
+	Acousticness     float64 `json:"acousticness"`
+	Danceability     float64 `json:"danceability"`
+	DurationMs       int     `json:"duration_ms"`
+	Energy           float64 `json:"energy"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Key              int     `json:"key"`
+	Liveness         float64 `json:"liveness"`
+	Loudness         float64 `json:"loudness"`
+	Mode             int     `json:"mode"`
+	Speechiness      float64 `json:"speechiness"`
+	Tempo            float64 `json:"tempo"`
+	TimeSignature    int     `json:"time_signature"`
+	Valence          float64 `json:"valence"`
+}
+
+// Value : feature named like a tunable attribute, false for attributes that
+// aren't audio features (popularity)
+func (f *AudioFeatures) Value(name string) (float64, bool) {
+	switch name {
+	case "acousticness":
+		return f.Acousticness, true
+	case "danceability":
+		return f.Danceability, true
+	case "duration_ms":
+		return float64(f.DurationMs), true
+	case "energy":
+		return f.Energy, true
+	case "instrumentalness":
+		return f.Instrumentalness, true
+	case "key":
+		return float64(f.Key), true
+	case "liveness":
+		return f.Liveness, true
+	case "loudness":
+		return f.Loudness, true
+	case "mode":
+		return float64(f.Mode), true
+	case "speechiness":
+		return f.Speechiness, true
+	case "tempo":
+		return f.Tempo, true
+	case "time_signature":
+		return float64(f.TimeSignature), true
+	case "valence":
+		return f.Valence, true
+	}
+	return 0, false
+}
+
+// GetAudioFeatures : audio features for track ids, fetched in batches of
+// MaxAudioFeaturesIDs and keyed by id. Tracks Spotify has no features for are missing.
+func (c *Client) GetAudioFeatures(ctx context.Context, token string, ids []string) (map[string]*AudioFeatures, error) {
+	features := make(map[string]*AudioFeatures, len(ids))
+	for start := 0; start < len(ids); start += MaxAudioFeaturesIDs {
+		end := start + MaxAudioFeaturesIDs
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var res struct {
+			AudioFeatures []*AudioFeatures `json:"audio_features"`
+		}
+		endpoint := "/audio-features?ids=" + url.QueryEscape(strings.Join(ids[start:end], ","))
+		if err := c.Get(ctx, token, endpoint, &res); err != nil {
+			return nil, err
+		}
+		for _, f := range res.AudioFeatures {
+			if f != nil {
+				features[f.ID] = f
+			}
+		}
+	}
+	return features, nil
+}
@@ -0,0 +1,135 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageOptions : paging parameters for the first page, zero values are omitted.
+// Offset pages by position, After by cursor on cursor-paged endpoints.
+type PageOptions struct {
+	Limit  int
+	Offset int
+	After  string
+}
+
+// apply : endpoint with the options added to its query
+func (o PageOptions) apply(endpoint string) string {
+	v := url.Values{}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		v.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.After != "" {
+		v.Set("after", o.After)
+	}
+	if len(v) == 0 {
+		return endpoint
+	}
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + v.Encode()
+}
+
+// Pager : iterates the pages of a paged endpoint by following next links
+type Pager[T any] struct {
+	client *Client
+	token  string
+	next   string
+	page   *Page[T]
+	err    error
+	decode func(body json.RawMessage) (*Page[T], error)
+}
+
+// NewPager : create a pager starting at endpoint (relative to BaseURL)
+func NewPager[T any](client *Client, token string, endpoint string, opts PageOptions) *Pager[T] {
+	return &Pager[T]{
+		client: client,
+		token:  token,
+		next:   opts.apply(endpoint),
+		decode: func(body json.RawMessage) (*Page[T], error) {
+			var page Page[T]
+			err := json.Unmarshal(body, &page)
+			return &page, err
+		},
+	}
+}
+
+// NewSearchPager : pager over the results of one search type, e.g. "track"
+func NewSearchPager[T any](client *Client, token string, query string, searchType string, opts SearchOptions) *Pager[T] {
+	return &Pager[T]{
+		client: client,
+		token:  token,
+		next:   SearchEndpoint(query, []string{searchType}, opts),
+		decode: func(body json.RawMessage) (*Page[T], error) {
+			// search nests each type's page under its plural, {"tracks": {...}}
+			var pages map[string]*Page[T]
+			if err := json.Unmarshal(body, &pages); err != nil {
+				return nil, err
+			}
+			page := pages[searchType+"s"]
+			if page == nil {
+				page = &Page[T]{}
+			}
+			return page, nil
+		},
+	}
+}
+
+// Next : fetch the next page, false when there are no more pages or on error
+func (p *Pager[T]) Next(ctx context.Context) bool {
+	if p.next == "" || p.err != nil {
+		return false
+	}
+	var body json.RawMessage
+	if p.err = p.client.Get(ctx, p.token, p.next, &body); p.err != nil {
+		return false
+	}
+	if p.page, p.err = p.decode(body); p.err != nil {
+		return false
+	}
+	p.next, p.err = p.client.relative(p.page.Next)
+	return p.err == nil || len(p.page.Items) > 0
+}
+
+// Page : page fetched by the last call to Next
+func (p *Pager[T]) Page() *Page[T] {
+	return p.page
+}
+
+// Err : error that stopped Next
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// All : collect the items of every remaining page, stopping after max items when max > 0
+func (p *Pager[T]) All(ctx context.Context, max int) ([]T, error) {
+	var items []T
+	for p.Next(ctx) {
+		items = append(items, p.page.Items...)
+		if max > 0 && len(items) >= max {
+			return items[:max], nil
+		}
+	}
+	return items, p.Err()
+}
+
+// relative : next link as an endpoint relative to BaseURL. Links elsewhere are
+// refused so the access token never leaves the api.
+func (c *Client) relative(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(link, c.BaseURL+"/") {
+		return "", fmt.Errorf("Unexpected next link %s", link)
+	}
+	return strings.TrimPrefix(link, c.BaseURL), nil
+}
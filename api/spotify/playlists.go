@@ -0,0 +1,133 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// MyPlaylists : pager over the current user's playlists
+func (c *Client) MyPlaylists(token string) *Pager[SimplePlaylist] {
+	return NewPager[SimplePlaylist](c, token, "/me/playlists", PageOptions{Limit: 50})
+}
+
+// PlaylistTrack : item of a playlist, Track is nil for tracks no longer available
+type PlaylistTrack struct {
+	AddedAt string `json:"added_at"`
+	Track   *Track `json:"track"`
+}
+
+// PlaylistTracks : pager over the tracks of a playlist
+func (c *Client) PlaylistTracks(token string, playlistID string) *Pager[PlaylistTrack] {
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	return NewPager[PlaylistTrack](c, token, endpoint, PageOptions{Limit: 100})
+}
+
+// GetPlaylist : fetch a playlist's details, without its tracks
+func (c *Client) GetPlaylist(ctx context.Context, token string, playlistID string) (*SimplePlaylist, error) {
+	var p SimplePlaylist
+	endpoint := fmt.Sprintf("/playlists/%s?fields=%s", url.PathEscape(playlistID),
+		url.QueryEscape("id,name,description,type,uri,public,collaborative,snapshot_id,owner,images,external_urls"))
+	if err := c.Get(ctx, token, endpoint, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreatePlaylist : create a playlist owned by userID
+func (c *Client) CreatePlaylist(ctx context.Context, token string, userID string, details PlaylistDetails) (*SimplePlaylist, error) {
+	var p SimplePlaylist
+	endpoint := fmt.Sprintf("/users/%s/playlists", url.PathEscape(userID))
+	if err := c.Post(ctx, token, endpoint, details, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MaxTracksPerRequest : most track uris one add or remove request accepts
+const MaxTracksPerRequest = 100
+
+// AddTracks : append track uris (at most 100) to a playlist, returning the new snapshot id
+func (c *Client) AddTracks(ctx context.Context, token string, playlistID string, uris []string) (string, error) {
+	return c.AddTracksAt(ctx, token, playlistID, uris, -1)
+}
+
+// AddTracksAt : insert track uris (at most 100) into a playlist at position,
+// appending when position is negative. Returns the new snapshot id.
+func (c *Client) AddTracksAt(ctx context.Context, token string, playlistID string, uris []string, position int) (string, error) {
+	var s snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	body := struct {
+		URIs     []string `json:"uris"`
+		Position *int     `json:"position,omitempty"`
+	}{URIs: uris}
+	if position >= 0 {
+		body.Position = &position
+	}
+	if err := c.Post(ctx, token, endpoint, body, &s); err != nil {
+		return "", err
+	}
+	return s.SnapshotID, nil
+}
+
+// UnfollowPlaylist : remove a playlist from the current user's library, which
+// is how spotify deletes a playlist the user owns
+func (c *Client) UnfollowPlaylist(ctx context.Context, token string, playlistID string) error {
+	endpoint := fmt.Sprintf("/playlists/%s/followers", url.PathEscape(playlistID))
+	return c.Delete(ctx, token, endpoint, nil, nil)
+}
+
+// ReplaceTracks : replace all tracks of a playlist with uris (at most 100),
+// returning the new snapshot id. An empty uris clears the playlist.
+func (c *Client) ReplaceTracks(ctx context.Context, token string, playlistID string, uris []string) (string, error) {
+	var s snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	if uris == nil {
+		uris = []string{}
+	}
+	body := struct {
+		URIs []string `json:"uris"`
+	}{uris}
+	if err := c.Put(ctx, token, endpoint, body, &s); err != nil {
+		return "", err
+	}
+	return s.SnapshotID, nil
+}
+
+// Reorder : move RangeLength tracks starting at RangeStart to before InsertBefore
+type Reorder struct {
+	RangeStart   int    `json:"range_start"`
+	InsertBefore int    `json:"insert_before"`
+	RangeLength  int    `json:"range_length,omitempty"`
+	SnapshotID   string `json:"snapshot_id,omitempty"`
+}
+
+// ReorderTracks : move a range of tracks within a playlist, returning the new snapshot id
+func (c *Client) ReorderTracks(ctx context.Context, token string, playlistID string, reorder Reorder) (string, error) {
+	var s snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	if err := c.Put(ctx, token, endpoint, reorder, &s); err != nil {
+		return "", err
+	}
+	return s.SnapshotID, nil
+}
+
+// RemoveTracks : remove every occurrence of uris (at most 100) from a
+// playlist, returning the new snapshot id
+func (c *Client) RemoveTracks(ctx context.Context, token string, playlistID string, uris []string) (string, error) {
+	var s snapshot
+	endpoint := fmt.Sprintf("/playlists/%s/tracks", url.PathEscape(playlistID))
+	type trackRef struct {
+		URI string `json:"uri"`
+	}
+	body := struct {
+		Tracks []trackRef `json:"tracks"`
+	}{}
+	for _, uri := range uris {
+		body.Tracks = append(body.Tracks, trackRef{uri})
+	}
+	if err := c.Delete(ctx, token, endpoint, body, &s); err != nil {
+		return "", err
+	}
+	return s.SnapshotID, nil
+}
@@ -0,0 +1,105 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxSeeds : most seed artists, tracks and genres combined per request
+	MaxSeeds = 5
+	// MaxRecommendations : largest recommendations limit
+	MaxRecommendations = 100
+)
+
+// Attribute : tunable track attribute and the range its values can take
+type Attribute struct {
+	Name    string
+	Min     float64
+	Max     float64
+	Integer bool
+}
+
+// Attributes : every tunable attribute /recommendations accepts
+var Attributes = []Attribute{
+	{Name: "acousticness", Min: 0, Max: 1},
+	{Name: "danceability", Min: 0, Max: 1},
+	{Name: "duration_ms", Min: 0, Max: 3600000, Integer: true},
+	{Name: "energy", Min: 0, Max: 1},
+	{Name: "instrumentalness", Min: 0, Max: 1},
+	{Name: "key", Min: 0, Max: 11, Integer: true},
+	{Name: "liveness", Min: 0, Max: 1},
+	{Name: "loudness", Min: -60, Max: 0},
+	{Name: "mode", Min: 0, Max: 1, Integer: true},
+	{Name: "popularity", Min: 0, Max: 100, Integer: true},
+	{Name: "speechiness", Min: 0, Max: 1},
+	{Name: "tempo", Min: 0, Max: 300},
+	{Name: "time_signature", Min: 3, Max: 7, Integer: true},
+	{Name: "valence", Min: 0, Max: 1},
+}
+
+// Tunable : min, max and target for one attribute, nil bounds are omitted
+type Tunable struct {
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Target *float64 `json:"target,omitempty"`
+}
+
+// RecommendationRequest : /recommendations parameters
+type RecommendationRequest struct {
+	SeedArtists []string
+	SeedTracks  []string
+	SeedGenres  []string
+	Limit       int
+	Market      string
+	// Tunables : keyed by attribute name, e.g. "energy"
+	Tunables map[string]Tunable
+}
+
+// Seeds : number of seeds of every kind
+func (req *RecommendationRequest) Seeds() int {
+	return len(req.SeedArtists) + len(req.SeedTracks) + len(req.SeedGenres)
+}
+
+// Values : query parameters for req
+func (req *RecommendationRequest) Values() url.Values {
+	v := url.Values{}
+	if len(req.SeedArtists) > 0 {
+		v.Set("seed_artists", strings.Join(req.SeedArtists, ","))
+	}
+	if len(req.SeedTracks) > 0 {
+		v.Set("seed_tracks", strings.Join(req.SeedTracks, ","))
+	}
+	if len(req.SeedGenres) > 0 {
+		v.Set("seed_genres", strings.Join(req.SeedGenres, ","))
+	}
+	if req.Limit > 0 {
+		v.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if req.Market != "" {
+		v.Set("market", req.Market)
+	}
+	for name, t := range req.Tunables {
+		setFloat(v, "min_"+name, t.Min)
+		setFloat(v, "max_"+name, t.Max)
+		setFloat(v, "target_"+name, t.Target)
+	}
+	return v
+}
+
+func setFloat(v url.Values, key string, f *float64) {
+	if f != nil {
+		v.Set(key, strconv.FormatFloat(*f, 'f', -1, 64))
+	}
+}
+
+// Recommendations : fetch recommendations for req
+func (c *Client) Recommendations(ctx context.Context, token string, req *RecommendationRequest) (*Recommendations, error) {
+	var rec Recommendations
+	if err := c.Get(ctx, token, "/recommendations?"+req.Values().Encode(), &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,139 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrRateLimited : Spotify kept answering 429 until retries ran out
+	ErrRateLimited = errors.New("Spotify rate limit exceeded")
+	// ErrUnavailable : Spotify kept answering 502/503/504 until retries ran out
+	ErrUnavailable = errors.New("Spotify unavailable")
+)
+
+// RetryPolicy : how requests answered with 429 or 502/503/504 are retried.
+// 429s wait for Retry-After, 5xx wait a jittered exponential backoff. The
+// total wait is capped by MaxWait and by the request context deadline.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	MaxWait    time.Duration
+}
+
+// DefaultRetryPolicy : retry policy used by NewClient
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  250 * time.Millisecond,
+	MaxDelay:   4 * time.Second,
+	MaxWait:    10 * time.Second,
+}
+
+// retryable : 429 is always safe to retry, 5xx only when the request may be
+// repeated without side effects
+func retryable(status int, idempotent bool) bool {
+	switch status {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// Backoff : full jitter exponential backoff for attempt (0 based)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// delay : how long to wait before retrying res
+func (p RetryPolicy) delay(attempt int, res *http.Response) time.Duration {
+	if res.StatusCode == http.StatusTooManyRequests {
+		if d, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return d
+		}
+	}
+	return p.Backoff(attempt)
+}
+
+// parseRetryAfter : Retry-After in delay-seconds or http-date form
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// exhausted : Error for the last response once retries ran out
+func exhausted(res *http.Response) error {
+	e := newError(res)
+	if res.StatusCode == http.StatusTooManyRequests {
+		e.err = ErrRateLimited
+	} else {
+		e.err = ErrUnavailable
+	}
+	return e
+}
+
+// send : build and send requests with newReq until one isn't retryable or
+// the retry policy runs out
+func (c *Client) send(ctx context.Context, idempotent bool, newReq func() (*http.Request, error)) (*http.Response, error) {
+	var waited time.Duration
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if !retryable(res.StatusCode, idempotent) {
+			return res, nil
+		}
+		if attempt >= c.Retry.MaxRetries {
+			return nil, exhausted(res)
+		}
+		d := c.Retry.delay(attempt, res)
+		if c.Retry.MaxWait > 0 && waited+d > c.Retry.MaxWait {
+			return nil, exhausted(res)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(d).After(deadline) {
+			return nil, exhausted(res)
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		waited += d
+	}
+}
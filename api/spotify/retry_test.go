@@ -0,0 +1,143 @@
+package spotify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	future := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header string
+		min    time.Duration
+		max    time.Duration
+		ok     bool
+	}{
+		{name: "empty", header: ""},
+		{name: "seconds", header: "3", min: 3 * time.Second, max: 3 * time.Second, ok: true},
+		{name: "zero", header: "0", ok: true},
+		{name: "negative", header: "-1"},
+		{name: "http date", header: future, min: 28 * time.Second, max: 30 * time.Second, ok: true},
+		{name: "garbage", header: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := parseRetryAfter(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if d < tt.min || d > tt.max {
+				t.Errorf("delay = %v, want %v to %v", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		min        time.Duration
+		max        time.Duration
+	}{
+		{name: "429 honours Retry-After", status: http.StatusTooManyRequests, retryAfter: "2", min: 2 * time.Second, max: 2 * time.Second},
+		{name: "429 without Retry-After backs off", status: http.StatusTooManyRequests, max: 100 * time.Millisecond},
+		{name: "503 ignores Retry-After", status: http.StatusServiceUnavailable, retryAfter: "2", max: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			if tt.retryAfter != "" {
+				res.Header.Set("Retry-After", tt.retryAfter)
+			}
+			if d := policy.delay(0, res); d < tt.min || d > tt.max {
+				t.Errorf("delay = %v, want %v to %v", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // answered in turn, the last one repeats
+		retryAfter   string
+		idempotent   bool
+		policy       RetryPolicy
+		timeout      time.Duration
+		wantStatus   int
+		wantErr      error
+		wantRequests int32
+	}{
+		{name: "429 retried until success", statuses: []int{429, 429, 200}, retryAfter: "0", policy: RetryPolicy{MaxRetries: 3},
+			wantStatus: 200, wantRequests: 3},
+		{name: "429 gives up after MaxRetries", statuses: []int{429}, retryAfter: "0", policy: RetryPolicy{MaxRetries: 2},
+			wantErr: ErrRateLimited, wantRequests: 3},
+		{name: "MaxWait caps Retry-After", statuses: []int{429, 200}, retryAfter: "5", policy: RetryPolicy{MaxRetries: 3, MaxWait: time.Second},
+			wantErr: ErrRateLimited, wantRequests: 1},
+		{name: "context deadline caps Retry-After", statuses: []int{429, 200}, retryAfter: "5", policy: RetryPolicy{MaxRetries: 3}, timeout: time.Second,
+			wantErr: ErrRateLimited, wantRequests: 1},
+		{name: "5xx retried when idempotent", statuses: []int{503, 502, 200}, idempotent: true,
+			policy: RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, wantStatus: 200, wantRequests: 3},
+		{name: "5xx gives up as unavailable", statuses: []int{504}, idempotent: true,
+			policy: RetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, wantErr: ErrUnavailable, wantRequests: 2},
+		{name: "5xx not retried otherwise", statuses: []int{503, 200}, policy: RetryPolicy{MaxRetries: 3},
+			wantStatus: 503, wantRequests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&requests, 1))
+				if n > len(tt.statuses) {
+					n = len(tt.statuses)
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer srv.Close()
+			c := NewClient(srv.Client())
+			c.Retry = tt.policy
+
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			res, err := c.send(ctx, tt.idempotent, func() (*http.Request, error) {
+				return http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			})
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %v, caps should give up without waiting", elapsed)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+				if res.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+				}
+			}
+			if got := atomic.LoadInt32(&requests); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
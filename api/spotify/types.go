@@ -0,0 +1,171 @@
+package spotify
+
+// Token : oauth2 token
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Page : spotify paging object, offset or cursor based
+type Page[T any] struct {
+	Href     string   `json:"href"`
+	Items    []T      `json:"items"`
+	Limit    int      `json:"limit"`
+	Next     string   `json:"next"`
+	Offset   int      `json:"offset"`
+	Previous string   `json:"previous"`
+	Total    int      `json:"total"`
+	Cursors  *Cursors `json:"cursors,omitempty"`
+}
+
+// Cursors : positions of a cursor based page
+type Cursors struct {
+	After  string `json:"after"`
+	Before string `json:"before,omitempty"`
+}
+
+// Image : cover art or profile image
+type Image struct {
+	URL    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+// ExternalURLs : links to the object on open.spotify.com
+type ExternalURLs struct {
+	Spotify string `json:"spotify"`
+}
+
+// ExternalIDs : industry identifiers for a track
+type ExternalIDs struct {
+	ISRC string `json:"isrc,omitempty"`
+}
+
+// Followers : follower count
+type Followers struct {
+	Total int `json:"total"`
+}
+
+// SimpleArtist : artist as embedded in tracks and albums
+type SimpleArtist struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name"`
+	Type         string       `json:"type"`
+	URI          string       `json:"uri"`
+	ExternalURLs ExternalURLs `json:"external_urls"`
+}
+
+// Artist : full artist object
+type Artist struct {
+	SimpleArtist
+	Genres     []string  `json:"genres"`
+	Images     []Image   `json:"images"`
+	Popularity int       `json:"popularity"`
+	Followers  Followers `json:"followers"`
+}
+
+// SimpleAlbum : album as embedded in tracks
+type SimpleAlbum struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Type         string         `json:"type"`
+	URI          string         `json:"uri"`
+	AlbumType    string         `json:"album_type"`
+	ReleaseDate  string         `json:"release_date"`
+	TotalTracks  int            `json:"total_tracks"`
+	Artists      []SimpleArtist `json:"artists"`
+	Images       []Image        `json:"images"`
+	ExternalURLs ExternalURLs   `json:"external_urls"`
+}
+
+// Track : full track object
+type Track struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Type         string         `json:"type"`
+	URI          string         `json:"uri"`
+	Artists      []SimpleArtist `json:"artists"`
+	Album        SimpleAlbum    `json:"album"`
+	DiscNumber   int            `json:"disc_number"`
+	TrackNumber  int            `json:"track_number"`
+	DurationMs   int            `json:"duration_ms"`
+	Explicit     bool           `json:"explicit"`
+	Popularity   int            `json:"popularity"`
+	PreviewURL   string         `json:"preview_url"`
+	IsPlayable   *bool          `json:"is_playable,omitempty"`
+	ExternalIDs  ExternalIDs    `json:"external_ids"`
+	ExternalURLs ExternalURLs   `json:"external_urls"`
+}
+
+// User : spotify user profile
+type User struct {
+	ID           string       `json:"id"`
+	DisplayName  string       `json:"display_name"`
+	Country      string       `json:"country,omitempty"`
+	Product      string       `json:"product,omitempty"`
+	Type         string       `json:"type"`
+	URI          string       `json:"uri"`
+	Images       []Image      `json:"images"`
+	ExternalURLs ExternalURLs `json:"external_urls"`
+}
+
+// PlaylistTracksRef : track count and link for a playlist
+type PlaylistTracksRef struct {
+	Href  string `json:"href"`
+	Total int    `json:"total"`
+}
+
+// SimplePlaylist : playlist as returned in lists and search results
+type SimplePlaylist struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Description   string            `json:"description"`
+	Type          string            `json:"type"`
+	URI           string            `json:"uri"`
+	Public        *bool             `json:"public"`
+	Collaborative bool              `json:"collaborative"`
+	SnapshotID    string            `json:"snapshot_id"`
+	Owner         User              `json:"owner"`
+	Images        []Image           `json:"images"`
+	Tracks        PlaylistTracksRef `json:"tracks"`
+	ExternalURLs  ExternalURLs      `json:"external_urls"`
+}
+
+// PlaylistDetails : settings for creating or changing a playlist
+type PlaylistDetails struct {
+	Name          string `json:"name"`
+	Description   string `json:"description,omitempty"`
+	Public        *bool  `json:"public,omitempty"`
+	Collaborative bool   `json:"collaborative,omitempty"`
+}
+
+// SearchResult : /search response, one page per requested type
+type SearchResult struct {
+	Artists   *Page[Artist]         `json:"artists,omitempty"`
+	Tracks    *Page[Track]          `json:"tracks,omitempty"`
+	Albums    *Page[SimpleAlbum]    `json:"albums,omitempty"`
+	Playlists *Page[SimplePlaylist] `json:"playlists,omitempty"`
+}
+
+// RecommendationSeed : seed used to generate recommendations
+type RecommendationSeed struct {
+	ID                 string `json:"id"`
+	Type               string `json:"type"`
+	Href               string `json:"href"`
+	InitialPoolSize    int    `json:"initialPoolSize"`
+	AfterFilteringSize int    `json:"afterFilteringSize"`
+	AfterRelinkingSize int    `json:"afterRelinkingSize"`
+}
+
+// Recommendations : /recommendations response
+type Recommendations struct {
+	Seeds  []RecommendationSeed `json:"seeds"`
+	Tracks []Track              `json:"tracks"`
+}
+
+type snapshot struct {
+	SnapshotID string `json:"snapshot_id"`
+}
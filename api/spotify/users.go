@@ -0,0 +1,12 @@
+package spotify
+
+import "context"
+
+// Me : fetch the current user's profile
+func (c *Client) Me(ctx context.Context, token string) (*User, error) {
+	var u User
+	if err := c.Get(ctx, token, "/me", &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
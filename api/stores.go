@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MemorySessionStore : sessions held in process memory
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// NewMemorySessionStore : create an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]Session)}
+}
+
+// Get : fetch a session by id
+func (m *MemorySessionStore) Get(id string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return &s, nil
+}
+
+// Save : store a session under its id
+func (m *MemorySessionStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+// Delete : remove a session by id
+func (m *MemorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteExpired : remove every session expired at now
+func (m *MemorySessionStore) DeleteExpired(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, s := range m.sessions {
+		if s.Expired(now) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// FileSessionStore : sessions stored as one json file per session in a directory
+type FileSessionStore struct {
+	mu  sync.RWMutex
+	dir string
+}
+
+// NewFileSessionStore : create a session store in dir, creating it if needed
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (f *FileSessionStore) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) {
+		return "", ErrSessionNotFound
+	}
+	return filepath.Join(f.dir, id+".json"), nil
+}
+
+// Get : fetch a session by id
+func (f *FileSessionStore) Get(id string) (*Session, error) {
+	p, err := f.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	file, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(file, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save : write a session to its file
+func (f *FileSessionStore) Save(s *Session) error {
+	p, err := f.path(s.ID)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// Delete : remove a session's file
+func (f *FileSessionStore) Delete(id string) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteExpired : remove the file of every session expired at now. Files that
+// can't be read as a session are left alone.
+func (f *FileSessionStore) DeleteExpired(now time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		p := filepath.Join(f.dir, entry.Name())
+		file, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var s Session
+		if json.Unmarshal(file, &s) != nil || !s.Expired(now) {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+var sessionsBucket = []byte("sessions")
+
+// BoltSessionStore : sessions stored in a bbolt database
+type BoltSessionStore struct {
+	db *bolt.DB
+}
+
+// NewBoltSessionStore : open (or create) a bbolt session database at path
+func NewBoltSessionStore(path string) (*BoltSessionStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(sessionsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltSessionStore{db: db}, nil
+}
+
+// Get : fetch a session by id
+func (b *BoltSessionStore) Get(id string) (*Session, error) {
+	var s Session
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(sessionsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrSessionNotFound
+		}
+		return json.Unmarshal(v, &s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Save : store a session under its id
+func (b *BoltSessionStore) Save(s *Session) error {
+	v, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(s.ID), v)
+	})
+}
+
+// Delete : remove a session by id
+func (b *BoltSessionStore) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(id))
+	})
+}
+
+// DeleteExpired : remove every session expired at now
+func (b *BoltSessionStore) DeleteExpired(now time.Time) (int, error) {
+	n := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			var s Session
+			if json.Unmarshal(v, &s) == nil && s.Expired(now) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, err
+}
+
+// NewSessionStore : create the session store selected by kind ("memory", "file" or "bolt")
+func NewSessionStore(kind string, path string) (SessionStore, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemorySessionStore(), nil
+	case "file":
+		return NewFileSessionStore(path)
+	case "bolt":
+		return NewBoltSessionStore(path)
+	default:
+		return nil, fmt.Errorf("Unknown session store %q", kind)
+	}
+}
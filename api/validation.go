@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxQueryLength : longest search query, in characters, passed on to Spotify
+const MaxQueryLength = 200
+
+var spotifyIDPattern = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// ValidSpotifyID : id is a 22 character base62 Spotify id
+func ValidSpotifyID(id string) bool {
+	return spotifyIDPattern.MatchString(id)
+}
+
+// FieldError : a request parameter that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator : reads request parameters, collecting an error for every
+// invalid one so they can all be reported at once
+type Validator struct {
+	Errors []FieldError
+}
+
+// Fail : record field as invalid
+func (v *Validator) Fail(field string, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Valid : no field has failed
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// ID : required Spotify id parameter
+func (v *Validator) ID(r *http.Request, name string) string {
+	id := r.URL.Query().Get(name)
+	switch {
+	case id == "":
+		v.Fail(name, "%s is required", name)
+	case !ValidSpotifyID(id):
+		v.Fail(name, "%s must be a 22 character base62 Spotify id", name)
+	}
+	return id
+}
+
+// Query : required search query, trimmed, without control characters and
+// at most MaxQueryLength characters
+func (v *Validator) Query(r *http.Request, name string) string {
+	q := strings.TrimSpace(r.URL.Query().Get(name))
+	switch {
+	case q == "":
+		v.Fail(name, "%s is required", name)
+	case utf8.RuneCountInString(q) > MaxQueryLength:
+		v.Fail(name, "%s must be at most %d characters", name, MaxQueryLength)
+	case strings.IndexFunc(q, unicode.IsControl) >= 0:
+		v.Fail(name, "%s can't contain control characters", name)
+	}
+	return q
+}
+
+// Int : integer parameter within [min, max], def when absent
+func (v *Validator) Int(r *http.Request, name string, def int, min int, max int) int {
+	n, err := intParam(r, name, def, min, max)
+	if err != nil {
+		v.Fail(name, err.Error())
+	}
+	return n
+}
+
+// Bool : "true" or "false" parameter, false when absent
+func (v *Validator) Bool(r *http.Request, name string) bool {
+	switch r.URL.Query().Get(name) {
+	case "", "false":
+		return false
+	case "true":
+		return true
+	}
+	v.Fail(name, "%s must be true or false", name)
+	return false
+}